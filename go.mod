@@ -7,6 +7,7 @@ require (
 	github.com/lxn/win v0.0.0-20210218163916-a377121e959e
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/sys v0.27.0
+	golang.org/x/text v0.21.0
 )
 
 require gopkg.in/Knetic/govaluate.v3 v3.0.0 // indirect
@@ -1,8 +1,11 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"unsafe"
 
@@ -34,6 +37,9 @@ const (
 	MOD_NOREPEAT = 0x4000
 )
 
+// maxSearchResults 搜索结果列表最多显示的脚本数量
+const maxSearchResults = 100
+
 type MSG struct {
 	HWND   uintptr
 	UINT   uint32
@@ -47,26 +53,29 @@ var showHelpAction *walk.Action
 
 // 辅助函数：从窗口句柄获取窗口对象
 type XScript struct {
-	window             *walk.MainWindow
-	notifyIcon         *walk.NotifyIcon
-	searchBox          *walk.LineEdit
-	logView            *walk.TextEdit
-	config             *config.AppConfig
-	logger             *logger.Logger
-	scripts            *script.Manager
-	resultList         *walk.ListBox
-	hotkey             *walk.GlobalHotKey
-	selectedScriptName string
+	window        *walk.MainWindow
+	notifyIcon    *walk.NotifyIcon
+	searchBox     *walk.LineEdit
+	logView       *walk.TextEdit
+	config        *config.AppConfig
+	logger        *logger.Logger
+	scripts       *script.Manager
+	resultList    *walk.ListBox
+	resultIDs     []string // 与 resultList 中的条目一一对应的脚本 ID
+	hotkey        *walk.GlobalHotKey
+	stopWatch     context.CancelFunc // 停止监视脚本目录
+	openLineStart int                // 日志中尚未结束的输出行的起始位置，-1 表示没有
 }
 
 // 创建 XScript 实例
 func New(cfg *config.AppConfig, log *logger.Logger) *XScript {
 	return &XScript{
-		config:     cfg,
-		logger:     log,
-		scripts:    script.NewManager(cfg, log),
-		resultList: nil,
-		hotkey:     nil,
+		config:        cfg,
+		logger:        log,
+		scripts:       script.NewManager(cfg, log),
+		resultList:    nil,
+		hotkey:        nil,
+		openLineStart: -1,
 	}
 }
 
@@ -77,6 +86,26 @@ func (app *XScript) cleanup() {
 		app.hotkey.Unregister()
 	}
 	app.logger.Debug("Hotkey unregistered")
+
+	if app.stopWatch != nil {
+		app.stopWatch()
+	}
+
+	// 先停止全部仍在运行的脚本再依次等待，各个脚本的宽限期同时计时
+	var stopped []string
+	for _, run := range app.scripts.ListRuns() {
+		if run.State.Finished() {
+			continue
+		}
+		if err := app.scripts.StopRun(run.ID); err != nil {
+			app.logger.WithError(err).Warn("Failed to stop script")
+			continue
+		}
+		stopped = append(stopped, run.ID)
+	}
+	for _, id := range stopped {
+		app.scripts.WaitRun(id)
+	}
 }
 
 // 运行
@@ -96,6 +125,11 @@ func (app *XScript) Run() error {
 		return err
 	}
 	app.logger.Debug("Main window created")
+	// 窗口显示后在后台检查 Python 解释器，不可用时只给出警告
+	go app.checkInterpreter()
+	for _, d := range app.scripts.Diagnostics() {
+		app.appendLog(fmt.Sprintf("scripts.json %s", d), true)
+	}
 
 	// 创建托盘图标
 	if err := app.createNotifyIcon(); err != nil {
@@ -111,6 +145,11 @@ func (app *XScript) Run() error {
 	}
 	app.logger.Debug("Hotkey registered")
 
+	// 监视脚本目录，变化时刷新列表
+	if app.config.WatchScripts {
+		app.watchScripts()
+	}
+
 	// 设置清理函数
 	app.window.Closing().Attach(func(canceled *bool, reason walk.CloseReason) {
 		app.cleanup()
@@ -355,24 +394,89 @@ func (app *XScript) appendLog(message string, isNewLine bool) {
 	}
 }
 
+// 显示脚本输出，不完整行和进度更新会替换日志中的当前行
+func (app *XScript) showOutput(event script.OutputEvent) {
+	if app.logView == nil {
+		return
+	}
+
+	if app.openLineStart >= 0 {
+		app.logView.SetTextSelection(app.openLineStart, app.logView.TextLength())
+		app.logView.ReplaceSelectedText("", false)
+		app.openLineStart = -1
+	}
+
+	if event.Kind == script.OutputLine {
+		app.appendLog(event.Text(), true)
+		return
+	}
+	app.openLineStart = app.logView.TextLength()
+	app.appendLog(event.Text(), false)
+}
+
 // 搜索脚本
 func (app *XScript) handleSearch() {
 	keyword := app.searchBox.Text()
-	results := app.scripts.Search(keyword)
+	results, err := app.scripts.Search(keyword, script.WithLimit(maxSearchResults))
 	app.logger.WithField("keyword", keyword).Debug("Searching scripts")
 
 	// Display search results in the log view
 	app.logView.SetText("") // Clear previous results
-	for _, script := range results {
-		app.appendLog(fmt.Sprintf("Found script: %s\r\n", script.Name), true)
-		app.logger.WithField("script", script.Name).Debug("Found script")
+	app.openLineStart = -1
+	if err != nil {
+		app.showQueryError(err)
+		app.updateResultList(nil)
+		return
+	}
+	for _, result := range results {
+		name := highlight(result.Script.Name, result.Ranges(script.FieldName))
+		app.appendLog(fmt.Sprintf("Found script: %s\r\n", name), true)
+		app.logger.WithFields(logger.Fields{
+			"script": result.Script.Name,
+			"score":  result.Score,
+		}).Debug("Found script")
 	}
 
-	// Update list model
+	app.updateResultList(results)
+}
+
+// showQueryError 显示查询语法错误，用方括号标出出错的位置
+func (app *XScript) showQueryError(err error) {
+	var syntaxErr *script.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		app.appendLog(fmt.Sprintf("Search failed: %v", err), true)
+		return
+	}
+	ranges := make([]script.Range, len(syntaxErr.Errors))
+	for i, qe := range syntaxErr.Errors {
+		ranges[i] = script.Range{Start: qe.Start, End: qe.End}
+		app.appendLog(fmt.Sprintf("Invalid query: %s", qe.Message), true)
+	}
+	app.appendLog(highlight(syntaxErr.Query, ranges), true)
+}
+
+// highlight 用方括号标出匹配到的字符
+func highlight(text string, ranges []script.Range) string {
+	var b strings.Builder
+	last := 0
+	for _, r := range ranges {
+		b.WriteString(text[last:r.Start])
+		b.WriteString("[" + text[r.Start:r.End] + "]")
+		last = r.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// 更新结果列表并选中第一项
+func (app *XScript) updateResultList(results []script.SearchResult) {
 	items := make([]string, len(results))
-	for i, script := range results {
-		items[i] = script.Name
+	ids := make([]string, len(results))
+	for i, result := range results {
+		items[i] = result.Script.Name
+		ids[i] = result.Script.ID
 	}
+	app.resultIDs = ids
 	app.resultList.SetModel(items)
 
 	// Select first result
@@ -381,6 +485,57 @@ func (app *XScript) handleSearch() {
 	}
 }
 
+// 检查 Python 解释器，在后台执行，结果显示在日志区域
+func (app *XScript) checkInterpreter() {
+	err := app.scripts.CheckInterpreter(context.Background())
+	if err == nil {
+		return
+	}
+	app.logger.WithError(err).Warn("Python interpreter check failed")
+	app.window.Synchronize(func() {
+		app.appendLog(fmt.Sprintf("Warning: %v", err), true)
+	})
+}
+
+// 监视脚本目录，重新加载后刷新结果列表
+func (app *XScript) watchScripts() {
+	ctx, cancel := context.WithCancel(context.Background())
+	events, unsubscribe := app.scripts.Subscribe()
+	if err := app.scripts.Watch(ctx); err != nil {
+		app.logger.WithError(err).Warn("Failed to watch scripts")
+		unsubscribe()
+		cancel()
+		return
+	}
+	app.stopWatch = cancel
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				if event.Type != script.EventCatalogChanged {
+					continue
+				}
+				app.window.Synchronize(func() {
+					if event.Err != nil {
+						app.appendLog(fmt.Sprintf("Failed to reload scripts: %v", event.Err), true)
+						return
+					}
+					app.appendLog("Scripts reloaded", true)
+					for _, d := range app.scripts.Diagnostics() {
+						app.appendLog(fmt.Sprintf("scripts.json %s", d), true)
+					}
+					results, _ := app.scripts.Search(app.searchBox.Text(), script.WithLimit(maxSearchResults))
+					app.updateResultList(results)
+				})
+			}
+		}
+	}()
+}
+
 // 显示关于对话框
 func (app *XScript) showAbout() {
 	app.logger.Debug("Showing about dialog")
@@ -438,36 +593,49 @@ func (app *XScript) showScriptList() {
 
 // 运行脚本
 func (app *XScript) runScript() {
-	keyword := app.searchBox.Text()
-	if keyword == "" {
-		keyword = app.selectedScriptName
+	results, err := app.scripts.Search(app.searchBox.Text(), script.WithLimit(1))
+	if err != nil {
+		app.showQueryError(err)
+		return
 	}
-	scripts := app.scripts.Search(keyword)
 
-	if len(scripts) == 0 {
+	if len(results) == 0 {
 		app.appendLog("No matching script found", true)
 		return
 	}
 
-	script := scripts[0]
-	app.appendLog(fmt.Sprintf("Executing script: %s", script.Name), true)
+	app.execute(results[0].Script)
+}
+
+// 在后台执行脚本
+func (app *XScript) execute(selected script.Script) {
+	app.appendLog(fmt.Sprintf("Executing script: %s", selected.Name), true)
 
 	// 在新的 goroutine 中执行脚本
 	go func() {
 		// 传入回调函数来处理输出
-		err := app.scripts.Execute(script, func(output string) {
+		run, err := app.scripts.ExecuteContext(context.Background(), selected, func(event script.OutputEvent) {
 			app.window.Synchronize(func() {
-				if app.logView != nil {
-					app.appendLog(output, true)
-				}
+				app.showOutput(event)
+			})
+		}, script.WithTrigger(script.TriggerGUI))
+		if err != nil {
+			app.logger.WithError(err).Error("Failed to start script")
+			app.window.Synchronize(func() {
+				app.appendLog(fmt.Sprintf("Error executing script: %v", err), true)
 			})
-		})
+			return
+		}
 
+		result, err := run.Wait()
 		if err != nil {
 			app.logger.WithError(err).Error("Failed to execute script")
-			app.appendLog(fmt.Sprintf("Error executing script: %v", err), true)
+			app.window.Synchronize(func() {
+				app.appendLog(fmt.Sprintf("Error executing script: %v", err), true)
+			})
 			return
 		}
+		app.logger.WithField("duration", result.Duration).Debug("Script execution finished")
 	}()
 }
 
@@ -519,17 +687,21 @@ func (app *XScript) handleSearchKeyDown(key walk.Key) {
 
 // 运行选中的脚本
 func (app *XScript) runSelectedScript() {
-	if app.resultList == nil || app.resultList.CurrentIndex() < 0 {
+	if app.resultList == nil {
+		return
+	}
+	index := app.resultList.CurrentIndex()
+	if index < 0 || index >= len(app.resultIDs) {
 		return
 	}
 
-	selectedName := app.resultList.Model().([]string)[app.resultList.CurrentIndex()]
-	results := app.scripts.Search(selectedName)
-
-	app.logger.WithField("selected script", selectedName).WithField("count", len(results)).Debug("Running selected script")
-	if len(results) > 0 {
-		// 设置选中的脚本名称到搜索框
-		app.selectedScriptName = selectedName
-		app.runScript() // 使用当前搜索框中的文本执行脚本
+	// 按 ID 查找，名称相同的脚本不会混淆
+	id := app.resultIDs[index]
+	selected, ok := app.scripts.GetScript(id)
+	app.logger.WithField("selected script", id).WithField("found", ok).Debug("Running selected script")
+	if !ok {
+		app.appendLog(fmt.Sprintf("Script %s no longer exists", id), true)
+		return
 	}
+	app.execute(selected)
 }
@@ -0,0 +1,632 @@
+// Package cli 实现 x-script 的命令行接口，带参数启动时使用
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yahao333/x-script/internal/script"
+	"github.com/yahao333/x-script/pkg/config"
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+// command 一个子命令
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(c *CLI, args []string) error
+}
+
+var commands = []command{
+	{"list", "list [--json] [--all]", "列出脚本，--all 包括隐藏的脚本", (*CLI).list},
+	{"search", "search [--json] [--all] <query>", "搜索脚本，支持 tag:、category:、lang:、status:、ran:、path: 过滤条件", (*CLI).search},
+	{"tags", "tags [--json]", "列出标签及使用数量", (*CLI).tags},
+	{"categories", "categories [--json]", "列出分类树及脚本数量", (*CLI).categories},
+	{"show", "show <id>", "显示脚本配置和运行状态", (*CLI).show},
+	{"add", "add --name <name> --path <path> [flags]", "添加脚本", (*CLI).add},
+	{"update", "update <id> [flags]", "修改脚本，只修改指定的字段", (*CLI).update},
+	{"remove", "remove <id>", "从 scripts.json 中删除脚本", (*CLI).remove},
+	{"move", "move <id> <index>", "调整脚本在 scripts.json 中的位置", (*CLI).move},
+	{"pin", "pin [<id> [<index>]]", "置顶脚本，指定 index 时移动到置顶列表中的该位置；不带参数时列出置顶的脚本", (*CLI).pin},
+	{"unpin", "unpin <id>", "取消置顶", (*CLI).unpin},
+	{"hide", "hide <id>", "隐藏脚本，隐藏的脚本默认不出现在列表和搜索结果中", (*CLI).hide},
+	{"unhide", "unhide <id>", "取消隐藏", (*CLI).unhide},
+	{"history", "history [--json] [--script <id>] [--status <states>] [--limit <n>] [--offset <n>] [<text>]", "查询运行历史，按开始时间从新到旧列出", (*CLI).history},
+}
+
+// CLI 命令行接口
+type CLI struct {
+	manager *script.Manager
+	logger  *logger.Logger
+	out     io.Writer
+	errOut  io.Writer
+}
+
+// New 创建命令行接口
+func New(cfg *config.AppConfig, log *logger.Logger) *CLI {
+	return &CLI{
+		manager: script.NewManager(cfg, log),
+		logger:  log,
+		out:     os.Stdout,
+		errOut:  os.Stderr,
+	}
+}
+
+// IsCommand 判断 name 是否为子命令或帮助参数，用于决定是否以命令行模式启动
+func IsCommand(name string) bool {
+	if isHelp(name) {
+		return true
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isHelp(arg string) bool {
+	return arg == "help" || arg == "-h" || arg == "--help"
+}
+
+// Run 执行 args 指定的命令，返回进程退出码
+func (c *CLI) Run(args []string) int {
+	if len(args) == 0 || isHelp(args[0]) {
+		c.usage()
+		return 0
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		// add 会创建 scripts.json，文件不存在时视为空的脚本目录
+		err := c.manager.Load()
+		if err != nil && !(cmd.name == "add" && errors.Is(err, os.ErrNotExist)) {
+			fmt.Fprintf(c.errOut, "error: %v\n", err)
+			return 1
+		}
+		if err := cmd.run(c, args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			c.logger.WithError(err).WithField("command", cmd.name).Error("Command failed")
+			fmt.Fprintf(c.errOut, "error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(c.errOut, "unknown command %q\n\n", args[0])
+	c.usage()
+	return 2
+}
+
+func (c *CLI) usage() {
+	fmt.Fprintln(c.errOut, "Usage: x-script <command> [arguments]")
+	fmt.Fprintln(c.errOut)
+	fmt.Fprintln(c.errOut, "Commands:")
+	w := tabwriter.NewWriter(c.errOut, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.usage, cmd.summary)
+	}
+	w.Flush()
+}
+
+// flagSet 创建子命令的参数解析器，错误输出到 errOut
+func (c *CLI) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("x-script "+name, flag.ContinueOnError)
+	fs.SetOutput(c.errOut)
+	return fs
+}
+
+// parseArgs 解析参数，允许参数和位置参数混合出现，返回位置参数
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (c *CLI) list(args []string) error {
+	fs := c.flagSet("list")
+	asJSON := fs.Bool("json", false, "输出 JSON")
+	all := fs.Bool("all", false, "包括隐藏的脚本")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	var scripts []script.Script
+	for _, s := range c.manager.GetScripts() {
+		if *all || !s.State.Hidden {
+			scripts = append(scripts, s)
+		}
+	}
+	if *asJSON {
+		return c.printJSON(scripts)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPATH\tLAST RUN\tSTATUS\tFLAGS")
+	for _, s := range scripts {
+		lastRun := "-"
+		if !s.State.LastRunTime.IsZero() {
+			lastRun = s.State.LastRunTime.Format("2006-01-02 15:04")
+		}
+		status := string(s.State.LastStatus)
+		if status == "" {
+			status = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Name, s.Path, lastRun, status, stateFlags(s.State))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, d := range c.manager.Diagnostics() {
+		fmt.Fprintln(c.errOut, d)
+	}
+	return nil
+}
+
+func (c *CLI) search(args []string) error {
+	fs := c.flagSet("search")
+	asJSON := fs.Bool("json", false, "输出 JSON")
+	all := fs.Bool("all", false, "包括隐藏的脚本")
+	// 查询中可以有 -tag:demo 这样的排除条件，第一个查询词之后不再解析参数，
+	// 查询以 - 开头时需要写在 -- 之后
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	var opts []script.SearchOption
+	if *all {
+		opts = append(opts, script.WithHidden())
+	}
+	results, err := c.manager.Search(query, opts...)
+	var syntaxErr *script.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		c.printSyntaxError(syntaxErr)
+		return errors.New("invalid query")
+	}
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		type result struct {
+			ID            string         `json:"id"`
+			Name          string         `json:"name"`
+			Score         float64        `json:"score"`
+			MatchedRanges []script.Range `json:"matched_ranges,omitempty"`
+		}
+		out := make([]result, len(results))
+		for i, r := range results {
+			out[i] = result{r.Script.ID, r.Script.Name, r.Score, r.MatchedRanges}
+		}
+		return c.printJSON(out)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCORE")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%.1f\n", r.Script.ID, r.Script.Name, r.Score)
+	}
+	return w.Flush()
+}
+
+func (c *CLI) tags(args []string) error {
+	fs := c.flagSet("tags")
+	asJSON := fs.Bool("json", false, "输出 JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	tags := c.manager.Tags()
+	if *asJSON {
+		return c.printJSON(tags)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tSCRIPTS")
+	for _, t := range tags {
+		fmt.Fprintf(w, "%s\t%d\n", t.Tag, t.Count)
+	}
+	return w.Flush()
+}
+
+func (c *CLI) categories(args []string) error {
+	fs := c.flagSet("categories")
+	asJSON := fs.Bool("json", false, "输出 JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	categories := c.manager.Categories()
+	if *asJSON {
+		return c.printJSON(categories)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CATEGORY\tSCRIPTS")
+	var printTree func(categories []script.Category, depth int)
+	printTree = func(categories []script.Category, depth int) {
+		for _, category := range categories {
+			fmt.Fprintf(w, "%s%s\t%d\n", strings.Repeat("  ", depth), category.Name, category.Count)
+			printTree(category.Children, depth+1)
+		}
+	}
+	printTree(categories, 0)
+	return w.Flush()
+}
+
+// printSyntaxError 输出查询和每处错误，用 ^ 标出出错的位置
+func (c *CLI) printSyntaxError(err *script.SyntaxError) {
+	for _, qe := range err.Errors {
+		fmt.Fprintf(c.errOut, "  %s\n", err.Query)
+		width := max(utf8.RuneCountInString(err.Query[qe.Start:qe.End]), 1)
+		fmt.Fprintf(c.errOut, "  %s%s %s\n",
+			strings.Repeat(" ", utf8.RuneCountInString(err.Query[:qe.Start])),
+			strings.Repeat("^", width), qe.Message)
+	}
+}
+
+func (c *CLI) show(args []string) error {
+	fs := c.flagSet("show")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: x-script show <id>")
+	}
+
+	s, ok := c.manager.GetScript(positional[0])
+	if !ok {
+		return fmt.Errorf("%w: %s", script.ErrScriptNotFound, positional[0])
+	}
+	return c.printJSON(struct {
+		script.Script
+		State      script.ScriptState `json:"state"`
+		Discovered bool               `json:"discovered,omitempty"`
+	}{s, s.State, s.Discovered})
+}
+
+// scriptFlags add 和 update 共用的参数
+type scriptFlags struct {
+	script.Script
+	env  stringList
+	tags tagList
+}
+
+func (c *CLI) scriptFlagSet(name string, f *scriptFlags) *flag.FlagSet {
+	fs := c.flagSet(name)
+	fs.StringVar(&f.ID, "id", "", "脚本 ID，默认根据路径生成")
+	fs.StringVar(&f.Name, "name", "", "显示名称")
+	fs.StringVar(&f.Path, "path", "", "脚本路径，相对于 scripts_dir")
+	fs.StringVar(&f.Description, "description", "", "描述")
+	fs.Var(&f.tags, "tags", "标签，用逗号分隔")
+	fs.StringVar(&f.Category, "category", "", "分类，用 / 分隔层级，如 dev/build")
+	fs.StringVar(&f.Interpreter, "interpreter", "", "解释器名称")
+	fs.StringVar(&f.Cwd, "cwd", "", "工作目录")
+	fs.StringVar(&f.OutputEncoding, "encoding", "", "输出编码")
+	fs.Var((*stringList)(&f.Args), "arg", "脚本参数，可重复")
+	fs.Var(&f.env, "env", "环境变量 KEY=VALUE，可重复")
+	return fs
+}
+
+// apply 把命令行中出现的参数写入脚本
+func (f *scriptFlags) apply(fs *flag.FlagSet, s *script.Script) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "id":
+			s.ID = f.ID
+		case "name":
+			s.Name = f.Name
+		case "path":
+			s.Path = f.Path
+		case "description":
+			s.Description = f.Description
+		case "tags":
+			s.Tags = f.tags
+		case "category":
+			s.Category = f.Category
+		case "interpreter":
+			s.Interpreter = f.Interpreter
+		case "cwd":
+			s.Cwd = f.Cwd
+		case "encoding":
+			s.OutputEncoding = f.OutputEncoding
+		case "arg":
+			s.Args = f.Args
+		case "env":
+			s.Env = make(map[string]string, len(f.env))
+			for _, kv := range f.env {
+				key, value, ok := strings.Cut(kv, "=")
+				if !ok {
+					err = fmt.Errorf("invalid env %q, expected KEY=VALUE", kv)
+					return
+				}
+				s.Env[key] = value
+			}
+		}
+	})
+	return err
+}
+
+func (c *CLI) add(args []string) error {
+	var f scriptFlags
+	fs := c.scriptFlagSet("add", &f)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	var s script.Script
+	if err := f.apply(fs, &s); err != nil {
+		return err
+	}
+	added, err := c.manager.AddScript(s)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "added %s\n", added.ID)
+	return nil
+}
+
+func (c *CLI) update(args []string) error {
+	var f scriptFlags
+	fs := c.scriptFlagSet("update", &f)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: x-script update <id> [flags]")
+	}
+
+	id := positional[0]
+	s, ok := c.manager.GetScript(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", script.ErrScriptNotFound, id)
+	}
+	if err := f.apply(fs, &s); err != nil {
+		return err
+	}
+	updated, err := c.manager.UpdateScript(id, s)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "updated %s\n", updated.ID)
+	return nil
+}
+
+func (c *CLI) remove(args []string) error {
+	fs := c.flagSet("remove")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: x-script remove <id>")
+	}
+
+	if err := c.manager.RemoveScript(positional[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "removed %s\n", positional[0])
+	return nil
+}
+
+func (c *CLI) move(args []string) error {
+	fs := c.flagSet("move")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: x-script move <id> <index>")
+	}
+	index, err := strconv.Atoi(positional[1])
+	if err != nil {
+		return fmt.Errorf("invalid index %q", positional[1])
+	}
+
+	return c.manager.MoveScript(positional[0], index)
+}
+
+func (c *CLI) pin(args []string) error {
+	fs := c.flagSet("pin")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	switch len(positional) {
+	case 0:
+		w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "INDEX\tID\tNAME")
+		for i, s := range c.manager.PinnedScripts() {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", i, s.ID, s.Name)
+		}
+		return w.Flush()
+	case 1, 2:
+	default:
+		return fmt.Errorf("usage: x-script pin [<id> [<index>]]")
+	}
+
+	id := positional[0]
+	if err := c.manager.SetPinned(id, true); err != nil {
+		return err
+	}
+	if len(positional) == 2 {
+		index, err := strconv.Atoi(positional[1])
+		if err != nil {
+			return fmt.Errorf("invalid index %q", positional[1])
+		}
+		if err := c.manager.MovePinned(id, index); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(c.out, "pinned %s\n", id)
+	return nil
+}
+
+func (c *CLI) unpin(args []string) error {
+	return c.setState("unpin", "unpinned", args, func(id string) error {
+		return c.manager.SetPinned(id, false)
+	})
+}
+
+func (c *CLI) hide(args []string) error {
+	return c.setState("hide", "hidden", args, func(id string) error {
+		return c.manager.SetHidden(id, true)
+	})
+}
+
+func (c *CLI) unhide(args []string) error {
+	return c.setState("unhide", "unhidden", args, func(id string) error {
+		return c.manager.SetHidden(id, false)
+	})
+}
+
+// setState 执行只有一个 id 参数的状态修改命令，成功后输出 done
+func (c *CLI) setState(name, done string, args []string, set func(id string) error) error {
+	fs := c.flagSet(name)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: x-script %s <id>", name)
+	}
+	if err := set(positional[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s %s\n", done, positional[0])
+	return nil
+}
+
+func (c *CLI) history(args []string) error {
+	fs := c.flagSet("history")
+	asJSON := fs.Bool("json", false, "输出 JSON")
+	scriptID := fs.String("script", "", "脚本 ID 或名称")
+	status := fs.String("status", "", "运行状态，用逗号分隔，如 failed,cancelled")
+	limit := fs.Int("limit", 0, "返回的记录数，默认 50")
+	offset := fs.Int("offset", 0, "跳过的记录数")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	q := script.HistoryQuery{
+		Script: *scriptID,
+		Text:   strings.Join(positional, " "),
+		Offset: *offset,
+		Limit:  *limit,
+	}
+	for _, state := range strings.Split(*status, ",") {
+		if state = strings.TrimSpace(state); state != "" {
+			q.States = append(q.States, script.RunState(state))
+		}
+	}
+	page, err := c.manager.History().Query(q)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return c.printJSON(page)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN ID\tSCRIPT\tSTATE\tEXIT\tSTART\tDURATION")
+	for _, r := range page.Records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", r.RunID, r.ScriptName, r.State, r.ExitCode,
+			r.StartTime.Format("2006-01-02 15:04:05"), r.Duration.Round(time.Millisecond))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if shown := *offset + len(page.Records); shown < page.Total {
+		fmt.Fprintf(c.errOut, "%d of %d records, use --offset %d for more\n", len(page.Records), page.Total, shown)
+	}
+	return nil
+}
+
+// stateFlags 返回列表中显示的置顶和隐藏标记
+func stateFlags(state script.ScriptState) string {
+	var flags []string
+	if state.Pinned {
+		flags = append(flags, "pinned")
+	}
+	if state.Hidden {
+		flags = append(flags, "hidden")
+	}
+	if len(flags) == 0 {
+		return "-"
+	}
+	return strings.Join(flags, ",")
+}
+
+func (c *CLI) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	return enc.Encode(v)
+}
+
+// stringList 可重复出现的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// tagList 逗号分隔的标签，可重复出现
+type tagList []string
+
+func (l *tagList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *tagList) Set(value string) error {
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			*l = append(*l, tag)
+		}
+	}
+	return nil
+}
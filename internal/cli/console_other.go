@@ -0,0 +1,6 @@
+//go:build !windows
+
+package cli
+
+// AttachConsole 只在 Windows 下需要，其他平台直接使用标准输出
+func AttachConsole() {}
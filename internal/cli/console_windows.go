@@ -0,0 +1,29 @@
+//go:build windows
+
+package cli
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var procAttachConsole = windows.NewLazySystemDLL("kernel32.dll").NewProc("AttachConsole")
+
+// attachParentProcess 对应 ATTACH_PARENT_PROCESS
+const attachParentProcess = ^uintptr(0)
+
+// AttachConsole 程序以 windowsgui 方式编译，没有自己的控制台。
+// 从命令行启动且输出没有重定向时，连接到父进程的控制台，使命令输出可见。
+func AttachConsole() {
+	if h, err := windows.GetStdHandle(windows.STD_OUTPUT_HANDLE); err == nil && h != 0 && h != windows.InvalidHandle {
+		return
+	}
+	if ret, _, _ := procAttachConsole.Call(attachParentProcess); ret == 0 {
+		return
+	}
+	if out, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0); err == nil {
+		os.Stdout = out
+		os.Stderr = out
+	}
+}
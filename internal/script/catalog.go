@@ -0,0 +1,309 @@
+package script
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Severity 诊断信息的级别
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // 条目无法使用，不会加载
+	SeverityWarning Severity = "warning" // 条目仍会加载
+)
+
+// Diagnostic 加载 scripts.json 时发现的问题
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Index    int      `json:"index"`          // 条目在 scripts.json 中的下标，自动发现的脚本为 -1
+	File     string   `json:"file,omitempty"` // 自动发现的脚本文件
+	ScriptID string   `json:"script_id,omitempty"`
+	Field    string   `json:"field,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%s: %s", d.Severity, entryLabel(d.Index, d.File))
+	if d.ScriptID != "" {
+		s += fmt.Sprintf(" (%s)", d.ScriptID)
+	}
+	if d.Field != "" {
+		s += " " + d.Field
+	}
+	return s + ": " + d.Message
+}
+
+// scriptIDPattern 限制 ID 的字符，保证可以用在命令行和 URL 中；汉字等各种文字的字母都可以使用
+var scriptIDPattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{M}\p{N}._/-]*$`)
+
+// pathIDReplacer 把路径中不能用于 ID 的字符替换为 "-"
+var pathIDReplacer = regexp.MustCompile(`[^\p{L}\p{M}\p{N}._/]+`)
+
+// validID 判断显式设置的 ID 是否可用，字母需要小写
+func validID(id string) bool {
+	return scriptIDPattern.MatchString(id) && strings.ToLower(id) == id
+}
+
+// deriveID 根据脚本路径生成 ID，如 "tools/Build Tools.py" 生成 "tools/build-tools"，
+// "工具/编译.py" 生成 "工具/编译"；路径中没有可用的字符时使用路径的哈希，如 "script-1a2b3c4d"
+func deriveID(path string) string {
+	slashed := filepath.ToSlash(path)
+	id := strings.TrimSuffix(slashed, filepath.Ext(slashed))
+	id = pathIDReplacer.ReplaceAllString(strings.ToLower(id), "-")
+	id = strings.Trim(id, "-./")
+	if id == "" {
+		return "script-" + pathHash(path)
+	}
+	return id
+}
+
+// pathHash 返回路径的短哈希，用于区分生成的 ID 相同的脚本
+func pathHash(path string) string {
+	sum := sha1.Sum([]byte(filepath.ToSlash(path)))
+	return hex.EncodeToString(sum[:4])
+}
+
+// assignIDs 返回每个脚本的 ID，没有显式 ID 时根据路径生成。
+// 生成的 ID 与显式 ID 或前面脚本的 ID 相同时加上路径的哈希，如 "build.py" 和 "build.sh"
+// 分别得到 "build" 和 "build-1a2b3c4d"；同一个文件登记多次时仍可能相同，需要设置显式 ID。
+func assignIDs(scripts []Script) []string {
+	ids := make([]string, len(scripts))
+	taken := make(map[string]bool, len(scripts))
+	for i, script := range scripts {
+		if script.ID != "" {
+			ids[i] = script.ID
+			taken[script.ID] = true
+		}
+	}
+	for i, script := range scripts {
+		if script.ID != "" {
+			continue
+		}
+		id := deriveID(script.Path)
+		if taken[id] {
+			id += "-" + pathHash(script.Path)
+		}
+		ids[i] = id
+		taken[id] = true
+	}
+	return ids
+}
+
+// catalogEntry scripts.json 中的一个条目；旧版本写入的 last_run_time 仅用于迁移，
+// 逗号分隔的 keywords 合并到 Tags 中
+type catalogEntry struct {
+	Script
+	LastRunTime time.Time `json:"last_run_time"`
+	Keywords    string    `json:"keywords"`
+
+	index int    // 条目在 scripts.json 中的下标，自动发现的脚本为 -1
+	file  string // 自动发现的脚本文件
+}
+
+// entryLabel 返回条目在诊断信息中的位置描述
+func entryLabel(index int, file string) string {
+	if index < 0 {
+		return file
+	}
+	return fmt.Sprintf("scripts[%d]", index)
+}
+
+// scriptFields 返回 Script 在 scripts.json 中的字段名
+func scriptFields() []string {
+	var fields []string
+	t := reflect.TypeOf(Script{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// knownFields 返回 scripts.json 条目允许出现的字段名
+func knownFields() map[string]bool {
+	fields := map[string]bool{"last_run_time": true, "keywords": true}
+	for _, name := range scriptFields() {
+		fields[name] = true
+	}
+	return fields
+}
+
+// parseCatalog 逐条解析 scripts.json，单个条目格式错误时只跳过该条目
+func parseCatalog(data []byte) ([]catalogEntry, []Diagnostic, error) {
+	var file struct {
+		Scripts []json.RawMessage `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, err
+	}
+
+	known := knownFields()
+	entries := make([]catalogEntry, 0, len(file.Scripts))
+	var diags []Diagnostic
+	for i, raw := range file.Scripts {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			diags = append(diags, Diagnostic{Severity: SeverityError, Index: i, Message: err.Error()})
+			continue
+		}
+
+		var entry catalogEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			d := Diagnostic{Severity: SeverityError, Index: i, Message: err.Error()}
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				d.Field = typeErr.Field
+				d.Message = fmt.Sprintf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+			}
+			diags = append(diags, d)
+			continue
+		}
+
+		for key := range fields {
+			if !known[key] {
+				diags = append(diags, Diagnostic{
+					Severity: SeverityWarning,
+					Index:    i,
+					Field:    key,
+					Message:  "unknown field",
+				})
+			}
+		}
+		entry.index = i
+		entries = append(entries, entry)
+	}
+	return entries, diags, nil
+}
+
+// validateCatalog 检查每个条目，返回可以使用的脚本和诊断信息
+func (m *Manager) validateCatalog(entries []catalogEntry) ([]Script, []Diagnostic) {
+	var diags []Diagnostic
+	scripts := make([]Script, 0, len(entries))
+	ids := make(map[string]string)
+	names := make(map[string]string)
+
+	assigned := make([]Script, len(entries))
+	for i, entry := range entries {
+		assigned[i] = entry.Script
+	}
+	assignedIDs := assignIDs(assigned)
+
+	for k, entry := range entries {
+		label := entryLabel(entry.index, entry.file)
+		script := entry.Script
+		script.Tags = normalizeTags(append(script.Tags, splitTags(entry.Keywords)...))
+		script.Category = normalizeCategory(script.Category)
+
+		explicit := script.ID != ""
+		script.ID = assignedIDs[k]
+		report := func(severity Severity, field, format string, args ...interface{}) {
+			diags = append(diags, Diagnostic{
+				Severity: severity,
+				Index:    entry.index,
+				File:     entry.file,
+				ScriptID: script.ID,
+				Field:    field,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		valid := true
+		fail := func(field string, err error) {
+			report(SeverityError, field, "%v", err)
+			valid = false
+		}
+
+		if script.Name == "" {
+			fail("name", errors.New("name is required"))
+		}
+		if err := m.validatePath(script.Path); err != nil {
+			fail("path", err)
+		}
+		if script.ID == "" {
+			fail("id", errors.New("id is required"))
+		} else if explicit && !validID(script.ID) {
+			fail("id", fmt.Errorf("invalid id %q, use lowercase letters, digits, '.', '_', '-' and '/'", script.ID))
+		}
+		if first, ok := ids[script.ID]; ok {
+			hint := ""
+			if !explicit {
+				hint = ", set an explicit id"
+			}
+			fail("id", fmt.Errorf("duplicate id %q, already used by %s%s", script.ID, first, hint))
+		}
+		if first, ok := names[script.Name]; ok && script.Name != "" {
+			report(SeverityWarning, "name", "duplicate name %q, already used by %s", script.Name, first)
+		}
+
+		if _, err := parseOutputEncoding(script.OutputEncoding); err != nil {
+			fail("output_encoding", err)
+		}
+		if err := m.validateCommand(script); err != nil {
+			fail("", err)
+		}
+		if err := validateParams(script.Params); err != nil {
+			fail("params", err)
+		}
+		if err := m.validateRequirements(script); err != nil {
+			fail("requirements", err)
+		}
+		if !valid {
+			continue
+		}
+
+		if _, ok := names[script.Name]; !ok {
+			names[script.Name] = label
+		}
+		ids[script.ID] = label
+
+		// 文件不存在时仍然加载，方便先登记再创建脚本
+		if info, err := os.Stat(filepath.Join(m.config.ScriptsDir, script.Path)); err != nil {
+			report(SeverityWarning, "path", "script file not accessible: %v", err)
+		} else if info.IsDir() {
+			report(SeverityWarning, "path", "%q is a directory", script.Path)
+		}
+
+		script.State = m.loadState(script, entry.LastRunTime)
+		scripts = append(scripts, script)
+	}
+	return scripts, diags
+}
+
+// validatePath 检查脚本路径，路径必须是 ScriptsDir 下的相对路径
+func (m *Manager) validatePath(path string) error {
+	if path == "" {
+		return errors.New("path is required")
+	}
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return fmt.Errorf("path %q must be relative to the scripts directory", path)
+	}
+	if strings.ContainsRune(path, 0) {
+		return fmt.Errorf("path %q contains NUL", path)
+	}
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path %q is outside the scripts directory", path)
+	}
+	return nil
+}
+
+// loadState 查找脚本的运行时状态，没有时使用 scripts.json 中旧版本的 last_run_time。
+// 只读取状态，检查条目时也会调用；按名称保存的旧状态由 Load 迁移。
+func (m *Manager) loadState(script Script, legacyRunTime time.Time) ScriptState {
+	if state, ok := m.state.get(script.ID); ok {
+		return state
+	}
+	return ScriptState{LastRunTime: legacyRunTime}
+}
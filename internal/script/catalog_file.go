@@ -0,0 +1,242 @@
+package script
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/yahao333/x-script/internal/utils"
+)
+
+// jsonMember JSON 对象中的一个字段
+type jsonMember struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// jsonObject 保持字段顺序的 JSON 对象，修改 scripts.json 时不打乱用户的写法，也不丢弃未知字段
+type jsonObject []jsonMember
+
+func parseJSONObject(data []byte) (jsonObject, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("expected JSON object")
+	}
+
+	var obj jsonObject
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		obj = append(obj, jsonMember{Key: tok.(string), Value: value})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+	return obj, nil
+}
+
+func (o jsonObject) get(key string) (json.RawMessage, bool) {
+	for _, member := range o {
+		if member.Key == key {
+			return member.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set 修改已有字段的值，字段不存在时追加到末尾
+func (o *jsonObject) set(key string, value json.RawMessage) {
+	for i := range *o {
+		if (*o)[i].Key == key {
+			(*o)[i].Value = value
+			return
+		}
+	}
+	*o = append(*o, jsonMember{Key: key, Value: value})
+}
+
+func (o *jsonObject) delete(key string) {
+	for i := range *o {
+		if (*o)[i].Key == key {
+			*o = append((*o)[:i], (*o)[i+1:]...)
+			return
+		}
+	}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := marshalJSON(member.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(member.Value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalJSON 序列化时不转义 <、> 和 &，保持 scripts.json 可读
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// catalogFile 用于修改的 scripts.json 内容
+type catalogFile struct {
+	path    string
+	root    jsonObject
+	entries []json.RawMessage
+}
+
+// catalogPath 返回 scripts.json 的路径
+func (m *Manager) catalogPath() string {
+	return filepath.Join(m.config.ScriptsDir, "scripts.json")
+}
+
+// readCatalogFile 读取 scripts.json，文件不存在时返回空目录
+func (m *Manager) readCatalogFile() (*catalogFile, error) {
+	file := &catalogFile{path: m.catalogPath()}
+
+	data, err := os.ReadFile(file.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read scripts config failed: %w", err)
+	}
+
+	root, err := parseJSONObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse scripts config failed: %w", err)
+	}
+	file.root = root
+	if raw, ok := root.get("scripts"); ok {
+		if err := json.Unmarshal(raw, &file.entries); err != nil {
+			return nil, fmt.Errorf("parse scripts config failed: %w", err)
+		}
+	}
+	return file, nil
+}
+
+// data 返回写回文件的内容，使用与原文件相同的四空格缩进
+func (f *catalogFile) data() ([]byte, error) {
+	if f.entries == nil {
+		f.entries = []json.RawMessage{}
+	}
+	entries, err := marshalJSON(f.entries)
+	if err != nil {
+		return nil, err
+	}
+	root := append(jsonObject(nil), f.root...)
+	root.set("scripts", entries)
+
+	compact, err := root.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, compact, "", "    "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// write 原子地写回 scripts.json
+func (f *catalogFile) write() error {
+	data, err := f.data()
+	if err != nil {
+		return fmt.Errorf("marshal scripts config failed: %w", err)
+	}
+	if err := utils.WriteFileAtomic(f.path, data, 0644); err != nil {
+		return fmt.Errorf("write scripts config failed: %w", err)
+	}
+	return nil
+}
+
+// find 返回 ID 对应条目的下标，没有时返回 -1。ID 按与 Load 相同的规则生成。
+func (f *catalogFile) find(id string) int {
+	var scripts []Script
+	var indexes []int
+	for i, raw := range f.entries {
+		var entry Script
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		scripts = append(scripts, entry)
+		indexes = append(indexes, i)
+	}
+	for k, entryID := range assignIDs(scripts) {
+		if entryID == id {
+			return indexes[k]
+		}
+	}
+	return -1
+}
+
+// encodeEntry 把脚本写入条目，保留原条目的字段顺序和未知字段。
+// ID 与根据路径生成的 ID 相同时不写入；旧版本的 keywords 已合并到标签中，写入时删除。
+func encodeEntry(original json.RawMessage, script Script) (json.RawMessage, error) {
+	if script.ID == deriveID(script.Path) {
+		script.ID = ""
+	}
+	script.Tags = normalizeTags(script.Tags)
+	script.Category = normalizeCategory(script.Category)
+	data, err := marshalJSON(script)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := parseJSONObject(data)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return data, nil
+	}
+
+	entry, err := parseJSONObject(original)
+	if err != nil {
+		return nil, err
+	}
+	// 脚本中值为空而被省略的字段从原条目中删除，未知字段保留
+	for _, key := range scriptFields() {
+		if _, ok := updated.get(key); !ok {
+			entry.delete(key)
+		}
+	}
+	entry.delete("keywords")
+	for _, member := range updated {
+		entry.set(member.Key, member.Value)
+	}
+	return entry.MarshalJSON()
+}
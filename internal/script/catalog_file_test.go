@@ -0,0 +1,124 @@
+package script
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONObjectRoundTrip(t *testing.T) {
+	tests := []string{
+		`{}`,
+		`{"z":1,"a":2,"m":3}`,
+		`{"name":"构建 <tools> & more","nested":{"b":[1,2],"a":null},"flag":true}`,
+		`{"dup":1,"dup":2}`,
+	}
+	for _, in := range tests {
+		obj, err := parseJSONObject([]byte(in))
+		if err != nil {
+			t.Fatalf("parse %s: %v", in, err)
+		}
+		out, err := obj.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != in {
+			t.Errorf("round trip of %s = %s", in, out)
+		}
+	}
+}
+
+func TestJSONObjectInvalid(t *testing.T) {
+	for _, in := range []string{``, `[]`, `"x"`, `{"a":1`, `{"a":1} {}`, `{"a":}`} {
+		if _, err := parseJSONObject([]byte(in)); err == nil {
+			t.Errorf("parse %q: expected an error", in)
+		}
+	}
+}
+
+func TestJSONObjectSetDelete(t *testing.T) {
+	obj, err := parseJSONObject([]byte(`{"a":1,"b":2,"c":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.set("b", json.RawMessage(`"two"`))
+	obj.set("d", json.RawMessage(`4`))
+	obj.delete("a")
+	obj.delete("missing")
+
+	out, err := obj.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"b":"two","c":3,"d":4}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	if value, ok := obj.get("c"); !ok || string(value) != "3" {
+		t.Errorf("get(c) = %s, %v", value, ok)
+	}
+}
+
+func TestEncodeEntryKeepsLayout(t *testing.T) {
+	original := json.RawMessage(`{"path":"tools/build.py","x-owner":"ops","name":"Build","keywords":"a,b","description":"old","cwd":"tools"}`)
+	script := Script{
+		ID:          deriveID("tools/build.py"),
+		Name:        "Build tools",
+		Path:        "tools/build.py",
+		Description: "Build all tools",
+		Tags:        []string{"a", "b", "A", " c "},
+	}
+
+	data, err := encodeEntry(original, script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 原有字段保持位置，未知字段保留，清空的 cwd 和旧的 keywords 删除，新字段追加在末尾，ID 与路径一致时不写入
+	want := `{"path":"tools/build.py","x-owner":"ops","name":"Build tools","description":"Build all tools","tags":["a","b","c"]}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+
+	data, err = encodeEntry(nil, Script{ID: "custom", Name: "New", Path: "new.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"id":"custom","name":"New","path":"new.sh","description":""}`; string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+}
+
+func TestCatalogFileRoundTrip(t *testing.T) {
+	m := newTestManager(t)
+	content := `{
+    "version": 2,
+    "scripts": [
+        {
+            "name": "Build",
+            "path": "build.py",
+            "x-note": "keep me"
+        }
+    ],
+    "x-extra": {
+        "b": 1,
+        "a": 2
+    }
+}
+`
+	path := filepath.Join(m.config.ScriptsDir, "scripts.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := m.readCatalogFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := file.data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("got\n%s\nwant\n%s", data, content)
+	}
+}
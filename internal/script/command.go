@@ -0,0 +1,177 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// envVarPattern 匹配 ${VAR} 形式的环境变量引用
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// buildCommand 根据脚本配置、解释器和运行参数创建命令，包括参数、环境变量和工作目录
+func (m *Manager) buildCommand(script Script, interp Interpreter, params *ResolvedParams) (*exec.Cmd, error) {
+	// 环境变量优先级：解释器配置 < 脚本配置 < 运行参数
+	env := m.scriptEnv(script, interp.Env)
+	lookup := envLookup(env)
+
+	scriptPath, err := filepath.Abs(filepath.Join(m.config.ScriptsDir, script.Path))
+	if err != nil {
+		return nil, fmt.Errorf("resolve script path failed: %w", err)
+	}
+
+	var args []string
+	if interp.Command != "" {
+		for _, arg := range interp.Args {
+			args = append(args, expandEnv(arg, lookup))
+		}
+	}
+	args = append(args, scriptPath)
+	for _, arg := range script.Args {
+		args = append(args, expandEnv(arg, lookup))
+	}
+	// 参数值由用户输入，不做变量展开
+	args = append(args, params.Args...)
+	for key, value := range params.Env {
+		env[key] = value
+	}
+
+	var cmd *exec.Cmd
+	if interp.Command == "" {
+		cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		cmd = exec.Command(expandEnv(interp.Command, lookup), args...)
+	}
+	cmd.Env = mergeEnv(m.baseEnv(script), env)
+
+	cwd, err := m.scriptDir(script, lookup)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Dir = cwd
+
+	return cmd, nil
+}
+
+// inheritEnv 返回脚本是否继承 x-script 自身的环境变量，默认继承
+func (s Script) inheritEnv() bool {
+	return s.InheritEnv == nil || *s.InheritEnv
+}
+
+// baseEnv 返回脚本环境变量的基础部分。
+// 不继承环境变量时，Windows 下仍保留 SYSTEMROOT，否则 Python 等程序无法正常启动。
+func (m *Manager) baseEnv(script Script) []string {
+	if script.inheritEnv() {
+		return os.Environ()
+	}
+	if root, ok := os.LookupEnv("SYSTEMROOT"); ok && runtime.GOOS == "windows" {
+		return []string{"SYSTEMROOT=" + root}
+	}
+	return nil
+}
+
+// scriptEnv 展开解释器和脚本配置的环境变量，${VAR} 引用 x-script 进程的环境变量
+func (m *Manager) scriptEnv(script Script, profileEnv map[string]string) map[string]string {
+	env := make(map[string]string, len(profileEnv)+len(script.Env))
+	for key, value := range profileEnv {
+		env[key] = expandEnv(value, os.LookupEnv)
+	}
+	for key, value := range script.Env {
+		env[key] = expandEnv(value, os.LookupEnv)
+	}
+	return env
+}
+
+// scriptDir 返回脚本的工作目录，未配置时使用 x-script 的当前目录，相对路径基于 ScriptsDir
+func (m *Manager) scriptDir(script Script, lookup func(string) (string, bool)) (string, error) {
+	if script.Cwd == "" {
+		return "", nil
+	}
+
+	dir := expandEnv(script.Cwd, lookup)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(m.config.ScriptsDir, dir)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolve working directory failed: %w", err)
+	}
+	return dir, nil
+}
+
+// validateCommand 检查脚本的参数、环境变量和工作目录配置
+func (m *Manager) validateCommand(script Script) error {
+	for key := range script.Env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid env name %q", key)
+		}
+	}
+
+	if _, err := m.resolveInterpreter(script); err != nil {
+		return err
+	}
+
+	cwd, err := m.scriptDir(script, envLookup(m.scriptEnv(script, nil)))
+	if err != nil {
+		return err
+	}
+	if cwd != "" {
+		info, err := os.Stat(cwd)
+		if err != nil {
+			return fmt.Errorf("working directory %q not accessible: %w", cwd, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("working directory %q is not a directory", cwd)
+		}
+	}
+	return nil
+}
+
+// envLookup 先查找脚本配置的环境变量，再查找 x-script 进程的环境变量
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		if value, ok := env[key]; ok {
+			return value, true
+		}
+		return os.LookupEnv(key)
+	}
+}
+
+// expandEnv 替换 ${VAR} 引用，未定义的变量替换为空字符串
+func expandEnv(s string, lookup func(string) (string, bool)) string {
+	return envVarPattern.ReplaceAllStringFunc(s, func(match string) string {
+		value, _ := lookup(match[2 : len(match)-1])
+		return value
+	})
+}
+
+// mergeEnv 用 overrides 覆盖 base 中的同名变量，Windows 下变量名不区分大小写
+func mergeEnv(base []string, overrides map[string]string) []string {
+	normalize := func(key string) string {
+		if runtime.GOOS == "windows" {
+			return strings.ToUpper(key)
+		}
+		return key
+	}
+
+	overridden := make(map[string]bool, len(overrides))
+	for key := range overrides {
+		overridden[normalize(key)] = true
+	}
+
+	env := make([]string, 0, len(base)+len(overrides))
+	for _, kv := range base {
+		key, _, _ := strings.Cut(kv, "=")
+		if !overridden[normalize(key)] {
+			env = append(env, kv)
+		}
+	}
+	for key, value := range overrides {
+		env = append(env, key+"="+value)
+	}
+	return env
+}
@@ -0,0 +1,122 @@
+package script
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yahao333/x-script/pkg/config"
+)
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"ROOT": "/srv", "NAME": "app", "EMPTY": ""}
+	tests := []struct {
+		in, want string
+	}{
+		{"${ROOT}/${NAME}", "/srv/app"},
+		{"${ROOT}${NAME}", "/srvapp"},
+		{"${MISSING}/bin", "/bin"},
+		{"x${EMPTY}y", "xy"},
+		{"$ROOT and %ROOT% are kept", "$ROOT and %ROOT% are kept"},
+		{"${1BAD} ${} ${ROOT", "${1BAD} ${} ${ROOT"},
+		{"no refs", "no refs"},
+	}
+	lookup := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	for _, tt := range tests {
+		if got := expandEnv(tt.in, lookup); got != tt.want {
+			t.Errorf("expandEnv(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuildCommandEnv(t *testing.T) {
+	t.Setenv("XS_TEST_HOST", "host-value")
+	t.Setenv("XS_TEST_SHARED", "host")
+
+	m := newTestManager(t)
+	interp := Interpreter{
+		Name: "tool",
+		InterpreterProfile: config.InterpreterProfile{
+			Command: "${TOOL_HOME}/tool",
+			Args:    []string{"--root=${XS_TEST_HOST}"},
+			Env:     map[string]string{"TOOL_HOME": "/opt/tool", "XS_TEST_SHARED": "profile", "LEVEL": "profile"},
+		},
+	}
+	script := Script{
+		Path: "build.tool",
+		Args: []string{"${OUT}/${XS_TEST_HOST}", "${UNSET_VAR}"},
+		Env:  map[string]string{"OUT": "${XS_TEST_HOST}/out", "LEVEL": "script"},
+		Cwd:  "${OUT}",
+	}
+	params := &ResolvedParams{
+		Args: []string{"--name", "${OUT}"},
+		Env:  map[string]string{"LEVEL": "param"},
+	}
+
+	cmd, err := m.buildCommand(script, interp, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "/opt/tool/tool"; cmd.Args[0] != want {
+		t.Errorf("command = %q, want %q", cmd.Args[0], want)
+	}
+	scriptPath, _ := filepath.Abs(filepath.Join(m.config.ScriptsDir, "build.tool"))
+	// 参数值由用户输入，不展开变量
+	wantArgs := []string{"--root=host-value", scriptPath, "host-value/out/host-value", "", "--name", "${OUT}"}
+	if !reflect.DeepEqual(cmd.Args[1:], wantArgs) {
+		t.Errorf("args = %q, want %q", cmd.Args[1:], wantArgs)
+	}
+
+	env := make(map[string]string)
+	for _, kv := range cmd.Env {
+		key, value, _ := strings.Cut(kv, "=")
+		env[key] = value
+	}
+	wantEnv := map[string]string{
+		"XS_TEST_HOST":   "host-value",
+		"XS_TEST_SHARED": "profile",
+		"TOOL_HOME":      "/opt/tool",
+		"OUT":            "host-value/out",
+		"LEVEL":          "param",
+	}
+	for key, want := range wantEnv {
+		if env[key] != want {
+			t.Errorf("env %s = %q, want %q", key, env[key], want)
+		}
+	}
+
+	wantDir, _ := filepath.Abs(filepath.Join(m.config.ScriptsDir, "host-value", "out"))
+	if cmd.Dir != wantDir {
+		t.Errorf("dir = %q, want %q", cmd.Dir, wantDir)
+	}
+}
+
+func TestBuildCommandWithoutInheritedEnv(t *testing.T) {
+	t.Setenv("XS_TEST_HOST", "host-value")
+
+	m := newTestManager(t)
+	inherit := false
+	script := Script{
+		Path:       "tool",
+		Env:        map[string]string{"FROM_HOST": "${XS_TEST_HOST}"},
+		InheritEnv: &inherit,
+	}
+	cmd, err := m.buildCommand(script, Interpreter{Name: InterpreterExec}, &ResolvedParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不继承时仍然可以用 ${VAR} 引用 x-script 的环境变量
+	for _, kv := range cmd.Env {
+		if strings.HasPrefix(kv, "XS_TEST_HOST=") {
+			t.Errorf("env contains inherited %q", kv)
+		}
+	}
+	if !containsString(cmd.Env, "FROM_HOST=host-value") {
+		t.Errorf("env = %q, want FROM_HOST=host-value", cmd.Env)
+	}
+}
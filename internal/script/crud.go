@@ -0,0 +1,222 @@
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+// ErrScriptNotFound 表示 scripts.json 中不存在指定 ID 的脚本
+var ErrScriptNotFound = errors.New("script not found")
+
+// ValidationError 脚本配置无效，Diagnostics 为导致失败的问题
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		if d.Field != "" {
+			messages[i] = d.Field + ": " + d.Message
+		} else {
+			messages[i] = d.Message
+		}
+	}
+	return "invalid script: " + strings.Join(messages, "; ")
+}
+
+// AddScript 在 scripts.json 末尾添加脚本，返回加载后的脚本
+func (m *Manager) AddScript(script Script) (Script, error) {
+	var id string
+	err := m.editCatalog(func(file *catalogFile) (int, error) {
+		if script.ID == "" {
+			// 生成的 ID 已被使用时加上路径的哈希，写入条目后保持不变
+			script.ID = deriveID(script.Path)
+			if file.find(script.ID) >= 0 {
+				script.ID += "-" + pathHash(script.Path)
+			}
+		}
+		id = script.ID
+		if file.find(id) >= 0 {
+			return 0, duplicateID(id)
+		}
+		entry, err := encodeEntry(nil, script)
+		if err != nil {
+			return 0, err
+		}
+		file.entries = append(file.entries, entry)
+		return len(file.entries) - 1, nil
+	})
+	if err != nil {
+		return Script{}, err
+	}
+	added, _ := m.GetScript(id)
+	m.logger.WithField("scriptID", id).Info("Script added")
+	return added, nil
+}
+
+// UpdateScript 用 script 替换 scripts.json 中的脚本，script.ID 为空时保持原 ID。
+// 只修改 Script 中的字段，条目中的其他字段保持不变；修改 ID 时运行状态和历史记录随之迁移。
+func (m *Manager) UpdateScript(id string, script Script) (Script, error) {
+	err := m.editCatalog(func(file *catalogFile) (int, error) {
+		i := file.find(id)
+		if i < 0 {
+			return 0, m.notFound(id)
+		}
+		if script.ID == "" {
+			script.ID = id
+		}
+		if script.ID != id && file.find(script.ID) >= 0 {
+			return 0, duplicateID(script.ID)
+		}
+		entry, err := encodeEntry(file.entries[i], script)
+		if err != nil {
+			return 0, err
+		}
+		file.entries[i] = entry
+		return i, nil
+	})
+	if err != nil {
+		return Script{}, err
+	}
+	if script.ID != id {
+		m.renameScript(id, script.ID)
+	}
+	updated, _ := m.GetScript(script.ID)
+	m.logger.WithField("scriptID", script.ID).Info("Script updated")
+	return updated, nil
+}
+
+// renameScript 把旧 ID 下的运行状态和历史记录迁移到新 ID，
+// 新 ID 已有状态时保留原状态，不合并
+func (m *Manager) renameScript(from, to string) {
+	log := m.logger.WithFields(logger.Fields{"from": from, "to": to})
+	if state, ok := m.state.rekey(from, to); ok {
+		if err := m.state.save(); err != nil {
+			log.WithError(err).Error("Failed to save script state")
+		}
+		m.updateScript(to, func(s *Script) {
+			s.State = state
+		})
+	} else if _, ok := m.state.get(from); ok {
+		log.Warn("State already exists for new script ID, old state kept")
+	}
+	if err := m.history.rekey(from, to); err != nil {
+		log.WithError(err).Error("Failed to migrate run history")
+	}
+}
+
+// RemoveScript 从 scripts.json 中删除脚本，运行状态和历史记录保留
+func (m *Manager) RemoveScript(id string) error {
+	err := m.editCatalog(func(file *catalogFile) (int, error) {
+		i := file.find(id)
+		if i < 0 {
+			return 0, m.notFound(id)
+		}
+		file.entries = append(file.entries[:i], file.entries[i+1:]...)
+		return -1, nil
+	})
+	if err != nil {
+		return err
+	}
+	m.logger.WithField("scriptID", id).Info("Script removed")
+	return nil
+}
+
+// MoveScript 把脚本移动到 scripts.json 中的 index 位置
+func (m *Manager) MoveScript(id string, index int) error {
+	err := m.editCatalog(func(file *catalogFile) (int, error) {
+		i := file.find(id)
+		if i < 0 {
+			return 0, m.notFound(id)
+		}
+		if index < 0 || index >= len(file.entries) {
+			return 0, fmt.Errorf("index %d out of range [0, %d)", index, len(file.entries))
+		}
+		entry := file.entries[i]
+		file.entries = append(file.entries[:i], file.entries[i+1:]...)
+		file.entries = append(file.entries[:index], append([]json.RawMessage{entry}, file.entries[index:]...)...)
+		return -1, nil
+	})
+	if err != nil {
+		return err
+	}
+	m.logger.WithFields(logger.Fields{
+		"scriptID": id,
+		"index":    index,
+	}).Info("Script moved")
+	return nil
+}
+
+// editCatalog 修改 scripts.json 并重新加载。
+// edit 返回被修改条目的下标，该条目有错误时不写入文件；返回 -1 表示不需要检查。
+func (m *Manager) editCatalog(edit func(*catalogFile) (int, error)) error {
+	m.catalogMu.Lock()
+	defer m.catalogMu.Unlock()
+
+	file, err := m.readCatalogFile()
+	if err != nil {
+		return err
+	}
+	index, err := edit(file)
+	if err != nil {
+		return err
+	}
+
+	data, err := file.data()
+	if err != nil {
+		return fmt.Errorf("marshal scripts config failed: %w", err)
+	}
+	if index >= 0 {
+		if err := m.checkEntry(data, index); err != nil {
+			return err
+		}
+	}
+
+	if err := file.write(); err != nil {
+		return err
+	}
+	return m.loadLocked()
+}
+
+// checkEntry 用与 Load 相同的规则检查修改后的条目
+func (m *Manager) checkEntry(data []byte, index int) error {
+	entries, diags, err := parseCatalog(data)
+	if err != nil {
+		return err
+	}
+	_, validateDiags := m.validateCatalog(entries)
+	diags = append(diags, validateDiags...)
+
+	var errs []Diagnostic
+	for _, d := range diags {
+		if d.Index == index && d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Diagnostics: errs}
+	}
+	return nil
+}
+
+func duplicateID(id string) error {
+	return &ValidationError{Diagnostics: []Diagnostic{{
+		Severity: SeverityError,
+		ScriptID: id,
+		Field:    "id",
+		Message:  fmt.Sprintf("duplicate id %q", id),
+	}}}
+}
+
+// notFound 返回脚本不存在的错误，自动发现的脚本需要先写入 scripts.json 才能修改
+func (m *Manager) notFound(id string) error {
+	if script, ok := m.GetScript(id); ok && script.Discovered {
+		return fmt.Errorf("script %q is discovered from %s, add it to scripts.json first: %w", id, script.Path, ErrScriptNotFound)
+	}
+	return fmt.Errorf("%w: %s", ErrScriptNotFound, id)
+}
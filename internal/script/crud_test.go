@@ -0,0 +1,49 @@
+package script
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateScriptRenameMigratesState(t *testing.T) {
+	m := newTestManager(t)
+	writeScriptFile(t, m, "build.py", "print(1)\n")
+	// scripts.json 不存在时可以直接添加
+	if _, err := m.AddScript(Script{ID: "old", Name: "Build", Path: "build.py"}); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := m.GetScript("old")
+	m.recordResult(old, RunSucceeded, &RunResult{StartTime: time.Now()})
+	if err := m.history.Append(HistoryRecord{RunID: "r1", ScriptID: "old", ScriptName: "Build"}); err != nil {
+		t.Fatal(err)
+	}
+
+	script, _ := m.GetScript("old")
+	script.ID = "new"
+	updated, err := m.UpdateScript("old", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != "new" || updated.State.RunCount != 1 {
+		t.Errorf("UpdateScript() = %+v, want script with ID new and one run", updated)
+	}
+	if _, ok := m.state.get("old"); ok {
+		t.Error("state still saved under old ID")
+	}
+
+	// 重新加载后状态仍在新 ID 下
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.GetScript("new"); s.State.RunCount != 1 {
+		t.Errorf("reloaded state = %+v, want one run", s.State)
+	}
+
+	page, err := m.history.Query(HistoryQuery{Script: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 1 || page.Records[0].ScriptID != "new" {
+		t.Errorf("history for new ID = %+v, want one migrated record", page.Records)
+	}
+}
@@ -0,0 +1,300 @@
+package script
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yahao333/x-script/pkg/config"
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+// 探测单个解释器的超时时间
+const interpreterProbeTimeout = 5 * time.Second
+
+// 探测 Python 版本的代码
+const pythonVersionProbe = "import sys; print('%d.%d.%d' % sys.version_info[:3])"
+
+// 解释器来源
+const (
+	SourceConfig     = "config"      // 脚本实际使用的解释器
+	SourcePythonPath = "python_path" // 被 interpreters 中的 python 覆盖的 python_path
+	SourcePath       = "path"
+	SourcePyenv      = "pyenv"
+	SourceVenv       = "venv"
+	SourceConda      = "conda"
+)
+
+// InterpreterInfo 发现的 Python 解释器及其探测结果
+type InterpreterInfo struct {
+	Path    string `json:"path"`
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// InterpreterError 配置的 Python 解释器不可用或版本过低
+type InterpreterError struct {
+	Configured string
+	Reason     string
+	Candidates []InterpreterInfo // 其他可用的解释器
+}
+
+func (e *InterpreterError) Error() string {
+	msg := fmt.Sprintf("python interpreter %q %s", e.Configured, e.Reason)
+	if len(e.Candidates) == 0 {
+		return msg + "; no other usable interpreter found"
+	}
+	paths := make([]string, len(e.Candidates))
+	for i, c := range e.Candidates {
+		paths[i] = fmt.Sprintf("%s (%s, %s)", c.Path, c.Version, c.Source)
+	}
+	return msg + "; usable interpreters: " + strings.Join(paths, ", ")
+}
+
+// Interpreters 查找可用的 Python 解释器并探测版本。
+// 查找范围包括配置的解释器、PATH、pyenv、ScriptsDir 下的虚拟环境和 conda 环境；
+// 配置的解释器与 CheckInterpreter 检查的相同，interpreters 中的 python 优先于 python_path。
+func Interpreters(ctx context.Context, cfg *config.AppConfig) []InterpreterInfo {
+	candidates := discoverPython(cfg)
+
+	var wg sync.WaitGroup
+	for i := range candidates {
+		wg.Add(1)
+		go func(info *InterpreterInfo) {
+			defer wg.Done()
+			probePython(ctx, info)
+		}(&candidates[i])
+	}
+	wg.Wait()
+
+	return candidates
+}
+
+// CheckInterpreter 检查配置的 Python 解释器是否可用且满足最低版本要求。
+// 只探测脚本实际使用的解释器，interpreters 中的 python 优先于 python_path；
+// 不可用时才查找其他解释器，列在错误中供用户选择。
+func (m *Manager) CheckInterpreter(ctx context.Context) error {
+	command := pythonCommand(m.config)
+	configured := InterpreterInfo{Source: SourceConfig}
+	var reason string
+	if path, err := exec.LookPath(command); err != nil {
+		reason = "not found"
+	} else {
+		configured.Path = path
+		probePython(ctx, &configured)
+		switch {
+		case !configured.OK:
+			reason = "does not work: " + configured.Error
+		case m.config.MinPythonVersion != "" && compareVersions(configured.Version, m.config.MinPythonVersion) < 0:
+			reason = fmt.Sprintf("version %s is older than required %s", configured.Version, m.config.MinPythonVersion)
+		}
+	}
+
+	if reason != "" {
+		var candidates []InterpreterInfo
+		for _, info := range Interpreters(ctx, m.config) {
+			if info.OK && info.Source != SourceConfig {
+				candidates = append(candidates, info)
+			}
+		}
+		return &InterpreterError{Configured: command, Reason: reason, Candidates: candidates}
+	}
+
+	m.logger.WithFields(logger.Fields{
+		"path":    configured.Path,
+		"version": configured.Version,
+	}).Info("Python interpreter checked")
+	return nil
+}
+
+// discoverPython 收集候选解释器路径，按真实路径去重
+func discoverPython(cfg *config.AppConfig) []InterpreterInfo {
+	var infos []InterpreterInfo
+	seen := make(map[string]bool)
+	add := func(path, source string) {
+		if !isExecutable(path) {
+			return
+		}
+		key := path
+		if abs, err := filepath.Abs(path); err == nil {
+			key = abs
+		}
+		if real, err := filepath.EvalSymlinks(key); err == nil {
+			key = real
+		}
+		// 配置的解释器总是保留，以便单独报告
+		if seen[key] && source != SourceConfig {
+			return
+		}
+		seen[key] = true
+		infos = append(infos, InterpreterInfo{Path: path, Source: source})
+	}
+
+	command := pythonCommand(cfg)
+	if path, err := exec.LookPath(command); err == nil {
+		add(path, SourceConfig)
+	}
+	if cfg.PythonPath != command {
+		if path, err := exec.LookPath(cfg.PythonPath); err == nil {
+			add(path, SourcePythonPath)
+		}
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		for _, name := range pythonNames() {
+			add(filepath.Join(dir, name), SourcePath)
+		}
+	}
+
+	for _, path := range pyenvPythons() {
+		add(path, SourcePyenv)
+	}
+
+	for _, dir := range venvDirs(cfg.ScriptsDir) {
+		add(venvPython(dir), SourceVenv)
+	}
+
+	for _, dir := range condaEnvs() {
+		add(condaPython(dir), SourceConda)
+	}
+
+	return infos
+}
+
+// probePython 运行解释器获取版本号
+func probePython(ctx context.Context, info *InterpreterInfo) {
+	ctx, cancel := context.WithTimeout(ctx, interpreterProbeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, info.Path, "-c", pythonVersionProbe).Output()
+	if err != nil {
+		info.Error = err.Error()
+		return
+	}
+	info.Version = strings.TrimSpace(string(out))
+	info.OK = info.Version != ""
+}
+
+func pythonNames() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"python.exe", "python3.exe"}
+	}
+	return []string{"python3", "python"}
+}
+
+// pyenvPythons 返回 pyenv（或 pyenv-win）的 shim 和已安装版本
+func pyenvPythons() []string {
+	root := os.Getenv("PYENV_ROOT")
+	if root == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		root = filepath.Join(home, ".pyenv")
+	}
+
+	var paths []string
+	if runtime.GOOS == "windows" {
+		root = filepath.Join(root, "pyenv-win")
+		paths = append(paths, filepath.Join(root, "shims", "python.bat"))
+		versions, _ := filepath.Glob(filepath.Join(root, "versions", "*", "python.exe"))
+		return append(paths, versions...)
+	}
+
+	for _, name := range pythonNames() {
+		paths = append(paths, filepath.Join(root, "shims", name))
+	}
+	versions, _ := filepath.Glob(filepath.Join(root, "versions", "*", "bin", "python3"))
+	return append(paths, versions...)
+}
+
+// venvDirs 返回 ScriptsDir 中的虚拟环境目录，包括常见名称和含 pyvenv.cfg 的子目录
+func venvDirs(scriptsDir string) []string {
+	dirs := []string{
+		filepath.Join(scriptsDir, ".venv"),
+		filepath.Join(scriptsDir, "venv"),
+	}
+	cfgs, _ := filepath.Glob(filepath.Join(scriptsDir, "*", "pyvenv.cfg"))
+	for _, cfg := range cfgs {
+		dirs = append(dirs, filepath.Dir(cfg))
+	}
+	return dirs
+}
+
+func venvPython(dir string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "Scripts", "python.exe")
+	}
+	return filepath.Join(dir, "bin", "python")
+}
+
+// condaEnvs 返回 conda 的 base 环境和其他环境目录
+func condaEnvs() []string {
+	var dirs []string
+	if prefix := os.Getenv("CONDA_PREFIX"); prefix != "" {
+		dirs = append(dirs, prefix)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dirs
+	}
+
+	// conda 在 environments.txt 中记录所有创建过的环境
+	if file, err := os.Open(filepath.Join(home, ".conda", "environments.txt")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				dirs = append(dirs, line)
+			}
+		}
+		file.Close()
+	}
+
+	for _, base := range []string{"anaconda3", "miniconda3", "miniforge3"} {
+		root := filepath.Join(home, base)
+		dirs = append(dirs, root)
+		envs, _ := filepath.Glob(filepath.Join(root, "envs", "*"))
+		dirs = append(dirs, envs...)
+	}
+	return dirs
+}
+
+func condaPython(dir string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "python.exe")
+	}
+	return filepath.Join(dir, "bin", "python")
+}
+
+// compareVersions 按数字逐段比较版本号，返回 -1、0 或 1
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
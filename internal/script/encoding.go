@@ -0,0 +1,174 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// 支持的输出编码名称
+const (
+	EncodingAuto    = "auto"
+	EncodingUTF8    = "utf-8"
+	EncodingGBK     = "gbk"
+	EncodingUTF16   = "utf-16"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+type outputEncoding int
+
+const (
+	encodingAuto outputEncoding = iota
+	encodingUTF8
+	encodingGBK
+	encodingUTF16
+	encodingUTF16LE
+	encodingUTF16BE
+)
+
+// parseOutputEncoding 解析编码名称，空字符串视为 auto
+func parseOutputEncoding(name string) (outputEncoding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", EncodingAuto:
+		return encodingAuto, nil
+	case EncodingUTF8, "utf8":
+		return encodingUTF8, nil
+	case EncodingGBK, "gb2312", "gb18030", "cp936":
+		return encodingGBK, nil
+	case EncodingUTF16, "utf16":
+		return encodingUTF16, nil
+	case EncodingUTF16LE, "utf16le":
+		return encodingUTF16LE, nil
+	case EncodingUTF16BE, "utf16be":
+		return encodingUTF16BE, nil
+	default:
+		return encodingAuto, fmt.Errorf("unsupported output encoding %q", name)
+	}
+}
+
+// utf16Decoder 返回 UTF-16 解码器，UTF-16 按 BOM 判断字节序，没有 BOM 时按小端处理
+func (e outputEncoding) utf16Decoder() *encoding.Decoder {
+	switch e {
+	case encodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder()
+	case encodingUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder()
+	case encodingUTF16:
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder()
+	default:
+		return nil
+	}
+}
+
+// outputDecoder 把一个输出流转换为 UTF-8。
+// UTF-16 在切分行之前按字节流转换；UTF-8 和 GBK 按行转换，auto 模式逐行检测。
+type outputDecoder struct {
+	encoding   outputEncoding
+	source     io.Reader
+	reader     io.Reader
+	transcoded atomic.Bool // 字节流已经转换为 UTF-8
+}
+
+func newOutputDecoder(enc outputEncoding, r io.Reader) *outputDecoder {
+	d := &outputDecoder{encoding: enc, source: r}
+	if dec := enc.utf16Decoder(); dec != nil {
+		d.reader = transform.NewReader(r, dec)
+		d.transcoded.Store(true)
+	}
+	return d
+}
+
+// Read 读取输出，auto 模式下根据第一块数据判断是否为 UTF-16
+func (d *outputDecoder) Read(p []byte) (int, error) {
+	if d.reader != nil {
+		return d.reader.Read(p)
+	}
+	if d.encoding != encodingAuto {
+		d.reader = d.source
+		return d.reader.Read(p)
+	}
+
+	n, err := d.source.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	head := append([]byte(nil), p[:n]...)
+	rest := io.MultiReader(bytes.NewReader(head), d.source)
+	if enc, ok := sniffUTF16(head); ok {
+		d.reader = transform.NewReader(rest, enc.utf16Decoder())
+		d.transcoded.Store(true)
+	} else {
+		d.reader = rest
+	}
+	return d.reader.Read(p)
+}
+
+// sniffUTF16 根据 BOM 或零字节的位置判断数据是否为 UTF-16
+func sniffUTF16(head []byte) (outputEncoding, bool) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}), bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return encodingUTF16, true
+	case len(head) >= 2 && head[0] != 0 && head[1] == 0:
+		return encodingUTF16LE, true
+	case len(head) >= 2 && head[0] == 0 && head[1] != 0:
+		return encodingUTF16BE, true
+	default:
+		return encodingAuto, false
+	}
+}
+
+// decode 把一行输出转换为合法的 UTF-8。
+// complete 为 false 时该行可能在多字节字符中间被截断，末尾不完整的字符会被暂时丢弃。
+func (d *outputDecoder) decode(data []byte, complete bool) []byte {
+	if d.transcoded.Load() || d.encoding == encodingUTF8 {
+		return toValidUTF8(data, complete)
+	}
+
+	if d.encoding == encodingAuto {
+		if trimmed := trimIncompleteUTF8(data, complete); utf8.Valid(trimmed) {
+			return trimmed
+		}
+	}
+
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return toValidUTF8(data, complete)
+	}
+	return toValidUTF8(decoded, true)
+}
+
+// toValidUTF8 把非法的 UTF-8 字节替换为 U+FFFD
+func toValidUTF8(data []byte, complete bool) []byte {
+	data = trimIncompleteUTF8(data, complete)
+	if utf8.Valid(data) {
+		return data
+	}
+	return bytes.ToValidUTF8(data, []byte("�"))
+}
+
+// trimIncompleteUTF8 去掉末尾被截断的多字节字符
+func trimIncompleteUTF8(data []byte, complete bool) []byte {
+	if complete {
+		return data
+	}
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(data[i]) {
+			continue
+		}
+		if !utf8.FullRune(data[i:]) {
+			return data[:i]
+		}
+		break
+	}
+	return data
+}
@@ -0,0 +1,205 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// chunkReader 每次最多返回 size 个字节，模拟管道分块读取
+type chunkReader struct {
+	data []byte
+	size int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(len(p), r.size)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// decodeLines 按脚本输出的处理方式解码数据，返回转换后的各行
+func decodeLines(t *testing.T, enc outputEncoding, data []byte, chunk int) []string {
+	t.Helper()
+	decoder := newOutputDecoder(enc, &chunkReader{data: data, size: chunk})
+	var lines []string
+	s := &lineSplitter{emit: func(kind OutputKind, data []byte) bool {
+		lines = append(lines, string(decoder.decode(data, kind == OutputLine)))
+		return true
+	}}
+	buf := make([]byte, chunk)
+	for {
+		n, err := decoder.Read(buf)
+		s.write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+	}
+	s.close()
+	return lines
+}
+
+func encodeGBK(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("encode gbk failed: %v", err)
+	}
+	return data
+}
+
+func encodeUTF16(t *testing.T, s string, order unicode.Endianness, bom unicode.BOMPolicy) []byte {
+	t.Helper()
+	data, err := unicode.UTF16(order, bom).NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("encode utf-16 failed: %v", err)
+	}
+	return data
+}
+
+func TestOutputDecoder(t *testing.T) {
+	gbkLine := encodeGBK(t, "编译完成\n")
+
+	tests := []struct {
+		name     string
+		encoding outputEncoding
+		data     []byte
+		want     []string
+	}{
+		{
+			name:     "auto utf-8",
+			encoding: encodingAuto,
+			data:     []byte("编译完成\nok\n"),
+			want:     []string{"编译完成", "ok"},
+		},
+		{
+			name:     "auto gbk",
+			encoding: encodingAuto,
+			data:     gbkLine,
+			want:     []string{"编译完成"},
+		},
+		{
+			name:     "auto detects each line",
+			encoding: encodingAuto,
+			data:     append([]byte("部署\n"), gbkLine...),
+			want:     []string{"部署", "编译完成"},
+		},
+		{
+			name:     "auto utf-16le with bom",
+			encoding: encodingAuto,
+			data:     encodeUTF16(t, "编译完成\r\nok\r\n", unicode.LittleEndian, unicode.UseBOM),
+			want:     []string{"编译完成", "ok"},
+		},
+		{
+			name:     "auto utf-16be with bom",
+			encoding: encodingAuto,
+			data:     encodeUTF16(t, "编译完成\n", unicode.BigEndian, unicode.UseBOM),
+			want:     []string{"编译完成"},
+		},
+		{
+			name:     "auto utf-16le without bom",
+			encoding: encodingAuto,
+			data:     encodeUTF16(t, "ok 编译\n", unicode.LittleEndian, unicode.IgnoreBOM),
+			want:     []string{"ok 编译"},
+		},
+		{
+			name:     "auto utf-16be without bom",
+			encoding: encodingAuto,
+			data:     encodeUTF16(t, "ok 编译\n", unicode.BigEndian, unicode.IgnoreBOM),
+			want:     []string{"ok 编译"},
+		},
+		{
+			name:     "gbk",
+			encoding: encodingGBK,
+			data:     gbkLine,
+			want:     []string{"编译完成"},
+		},
+		{
+			name:     "utf-16le",
+			encoding: encodingUTF16LE,
+			data:     encodeUTF16(t, "编译完成\n", unicode.LittleEndian, unicode.IgnoreBOM),
+			want:     []string{"编译完成"},
+		},
+		{
+			name:     "utf-8 replaces invalid bytes",
+			encoding: encodingUTF8,
+			data:     []byte("a\xffb\n"),
+			want:     []string{"a�b"},
+		},
+	}
+
+	for _, tt := range tests {
+		// 奇数大小的分块会把 UTF-16 码元和多字节字符切开
+		for _, chunk := range []int{3, 4096} {
+			t.Run(fmt.Sprintf("%s/chunk=%d", tt.name, chunk), func(t *testing.T) {
+				got := decodeLines(t, tt.encoding, tt.data, chunk)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestSniffUTF16(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want outputEncoding
+		ok   bool
+	}{
+		{"bom little endian", []byte{0xFF, 0xFE, 'a', 0}, encodingUTF16, true},
+		{"bom big endian", []byte{0xFE, 0xFF, 0, 'a'}, encodingUTF16, true},
+		{"little endian", []byte{'a', 0, 'b', 0}, encodingUTF16LE, true},
+		{"big endian", []byte{0, 'a', 0, 'b'}, encodingUTF16BE, true},
+		{"ascii", []byte("ab"), encodingAuto, false},
+		{"utf-8", []byte("编译"), encodingAuto, false},
+		{"too short", []byte{'a'}, encodingAuto, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sniffUTF16(tt.head)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("sniffUTF16(%v) = %v, %v, want %v, %v", tt.head, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestOutputDecoderPartialLine(t *testing.T) {
+	utf8Text := []byte("编译")
+	gbkText := encodeGBK(t, "编译")
+
+	tests := []struct {
+		name     string
+		encoding outputEncoding
+		data     []byte
+		complete bool
+		want     string
+	}{
+		{"utf-8 cut in character", encodingAuto, utf8Text[:4], false, "编"},
+		{"utf-8 complete", encodingAuto, utf8Text, false, "编译"},
+		{"utf-8 truncated line end", encodingUTF8, utf8Text[:4], true, "编�"},
+		{"gbk partial", encodingAuto, gbkText, false, "编译"},
+		{"gbk", encodingGBK, gbkText, true, "编译"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newOutputDecoder(tt.encoding, bytes.NewReader(nil))
+			if got := string(d.decode(tt.data, tt.complete)); got != tt.want {
+				t.Errorf("decode(%q, %v) = %q, want %q", tt.data, tt.complete, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package script
+
+import (
+	"sync"
+	"time"
+)
+
+// 每个订阅者的事件缓冲区大小，消费过慢时丢弃新事件并在之后补发 EventCatalogChanged
+const subscriberBuffer = 64
+
+// EventType 变更事件的类型
+type EventType string
+
+const (
+	// EventCatalogChanged 脚本目录重新加载，或者订阅者丢弃过事件；
+	// Err 不为 nil 时仍使用上一次成功加载的脚本
+	EventCatalogChanged EventType = "catalog_changed"
+	EventScriptAdded    EventType = "script_added"
+	EventScriptUpdated  EventType = "script_updated" // 包括运行状态的变化
+	EventScriptRemoved  EventType = "script_removed"
+	EventRunStarted     EventType = "run_started"
+	EventRunFinished    EventType = "run_finished"
+)
+
+// Event Manager 发出的变更事件
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	ScriptID string
+	Script   *Script  // 脚本新增和修改事件中的脚本
+	RunID    string   // 运行事件
+	State    RunState // 运行事件
+	Err      error    // 重新加载失败或运行失败的原因
+}
+
+// subscribers 管理事件订阅者
+type subscribers struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]*subscriber
+}
+
+// subscriber 一个订阅者，lagging 时丢弃新事件，等待补发的 EventCatalogChanged 送达
+type subscriber struct {
+	ch      chan Event
+	done    chan struct{}
+	lagging bool
+	missed  bool // 开始补发之后是否又丢弃过事件
+	resync  sync.WaitGroup
+}
+
+// Subscribe 订阅变更事件，返回的函数用于取消订阅并关闭通道。
+// 每个订阅者按发生顺序收到事件，不会阻塞 Manager。缓冲区满时丢弃之后的事件，
+// 等订阅者取走事件后补发一个 EventCatalogChanged，订阅者收到后应重新读取全部状态。
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	s := &m.subscribers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.subs == nil {
+		s.subs = make(map[int]*subscriber)
+	}
+	id := s.next
+	s.next++
+	sub := &subscriber{
+		ch:   make(chan Event, subscriberBuffer),
+		done: make(chan struct{}),
+	}
+	s.subs[id] = sub
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subs, id)
+			s.mu.Unlock()
+
+			// 等待补发事件的 goroutine 退出后才能关闭通道
+			close(sub.done)
+			sub.resync.Wait()
+			close(sub.ch)
+		})
+	}
+}
+
+// publish 把事件发给所有订阅者，不会阻塞
+func (m *Manager) publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	s := &m.subscribers
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs {
+		if sub.lagging {
+			sub.missed = true
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			m.logger.WithField("type", event.Type).Warn("Subscriber too slow, events dropped until resync")
+			sub.lagging = true
+			sub.resync.Add(1)
+			go m.resync(sub, event.Time)
+		}
+	}
+}
+
+// resync 在订阅者的缓冲区有空位时补发 EventCatalogChanged，代替期间丢弃的事件。
+// 送达之后又丢弃了事件时再补发一次。
+func (m *Manager) resync(sub *subscriber, t time.Time) {
+	defer sub.resync.Done()
+	s := &m.subscribers
+	for {
+		s.mu.Lock()
+		sub.missed = false
+		s.mu.Unlock()
+
+		select {
+		case sub.ch <- Event{Type: EventCatalogChanged, Time: t}:
+		case <-sub.done:
+			return
+		}
+
+		s.mu.Lock()
+		if !sub.missed {
+			sub.lagging = false
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+		t = time.Now()
+	}
+}
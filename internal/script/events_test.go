@@ -0,0 +1,61 @@
+package script
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeResyncAfterOverflow(t *testing.T) {
+	m := newTestManager(t)
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	// 超出缓冲区的事件被丢弃，取走事件后补发目录变更事件
+	for i := 0; i < subscriberBuffer+10; i++ {
+		m.publish(Event{Type: EventRunStarted, RunID: "r"})
+	}
+	for i := 0; i < subscriberBuffer; i++ {
+		if event := <-events; event.Type != EventRunStarted {
+			t.Fatalf("event %d = %s, want %s", i, event.Type, EventRunStarted)
+		}
+	}
+	select {
+	case event := <-events:
+		if event.Type != EventCatalogChanged {
+			t.Fatalf("event after overflow = %s, want %s", event.Type, EventCatalogChanged)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no resync event after overflow")
+	}
+
+	// 补发之后恢复正常投递，期间丢弃的事件会再补发一次
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.publish(Event{Type: EventRunFinished, RunID: "r"})
+		select {
+		case event := <-events:
+			if event.Type == EventCatalogChanged {
+				continue
+			}
+			if event.Type != EventRunFinished {
+				t.Fatalf("event after resync = %s, want %s", event.Type, EventRunFinished)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+			if time.Now().After(deadline) {
+				t.Fatal("events still dropped after resync")
+			}
+		}
+	}
+}
+
+func TestUnsubscribeWhileLagging(t *testing.T) {
+	m := newTestManager(t)
+	events, unsubscribe := m.Subscribe()
+	for i := 0; i < subscriberBuffer+1; i++ {
+		m.publish(Event{Type: EventRunStarted})
+	}
+	unsubscribe()
+	for range events {
+	}
+}
@@ -0,0 +1,376 @@
+package script
+
+import (
+	"math/bits"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 模糊匹配的分数，参考 fzf：每个匹配字符得分，在单词开头匹配有额外加分，跳过字符扣分
+const (
+	scoreMatch        = 16
+	scoreGapStart     = 3
+	scoreGapExtension = 1
+
+	bonusBoundary    = scoreMatch / 2 // 字符串开头或分隔符之后
+	bonusCamel       = bonusBoundary - 1
+	bonusConsecutive = scoreGapStart + scoreGapExtension
+
+	// 模式的第一个字符落在单词开头时加倍，"bt" 匹配 build_tools 优于 about
+	bonusFirstCharMultiplier = 2
+)
+
+// maxFuzzyText 参与模糊匹配的最大字符数，避免很长的文本使动态规划过慢
+const maxFuzzyText = 256
+
+// Range 字段 Field 中匹配到的字节范围 [Start, End)
+type Range struct {
+	Field string `json:"field"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type charClass int
+
+const (
+	classOther charClass = iota
+	classDelimiter
+	classLower
+	classUpper
+	classDigit
+	classLetter // 没有大小写的字母，如汉字
+)
+
+func classOf(r rune) charClass {
+	switch {
+	case unicode.IsLower(r):
+		return classLower
+	case unicode.IsUpper(r):
+		return classUpper
+	case unicode.IsDigit(r):
+		return classDigit
+	case unicode.IsLetter(r):
+		return classLetter
+	case unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r):
+		return classDelimiter
+	default:
+		return classOther
+	}
+}
+
+// bonusFor 返回在 prev 之后出现 cur 时的位置加分
+func bonusFor(prev, cur charClass) int {
+	if cur == classDelimiter || cur == classOther {
+		return 0
+	}
+	switch {
+	case prev == classDelimiter || prev == classOther:
+		return bonusBoundary
+	case prev == classLower && cur == classUpper:
+		return bonusCamel
+	case prev != classDigit && cur == classDigit, prev == classDigit && cur != classDigit:
+		return bonusCamel
+	case prev != cur && (prev == classLetter || cur == classLetter):
+		// 中英文交界处，如 "编译scts" 中的 s
+		return bonusCamel
+	}
+	return 0
+}
+
+// fuzzyText 预处理后的待匹配文本。
+// 每个字符记录它在原文中的字节范围，拼音等转换后的文本也能把匹配位置对应回原文。
+type fuzzyText struct {
+	runes  []rune // 小写
+	bonus  []int8
+	starts []int32
+	ends   []int32
+}
+
+func (t *fuzzyText) append(r rune, bonus, start, end int) {
+	r = unicode.ToLower(r)
+	t.runes = append(t.runes, r)
+	t.bonus = append(t.bonus, int8(bonus))
+	t.starts = append(t.starts, int32(start))
+	t.ends = append(t.ends, int32(end))
+}
+
+// grow 预留 n 个字符的空间
+func (t *fuzzyText) grow(n int) {
+	n = min(n, maxFuzzyText)
+	t.runes = make([]rune, 0, n)
+	t.bonus = make([]int8, 0, n)
+	t.starts = make([]int32, 0, n)
+	t.ends = make([]int32, 0, n)
+}
+
+func newFuzzyText(s string) fuzzyText {
+	var t fuzzyText
+	t.grow(utf8.RuneCountInString(s))
+	prev := classDelimiter
+	for i, r := range s {
+		if len(t.runes) == maxFuzzyText {
+			break
+		}
+		class := classOf(r)
+		t.append(r, bonusFor(prev, class), i, i+utf8.RuneLen(r))
+		prev = class
+	}
+	return t
+}
+
+// runeMask 返回字符在 64 位掩码中对应的位
+func runeMask(r rune) uint64 {
+	return 1 << (uint(r) % 64)
+}
+
+// patternMask 返回 pattern 中所有字符的掩码，文本的掩码不包含它时一定不匹配
+func patternMask(pattern []rune) uint64 {
+	var mask uint64
+	for _, r := range pattern {
+		mask |= runeMask(r)
+	}
+	return mask
+}
+
+// pairMask 返回文本中先后出现（不一定相邻）的字符对的 128 位掩码。
+// pattern 是文本的子序列时，pattern 中的字符对都在文本中先后出现，文本的掩码一定包含 pattern 的掩码。
+func pairMask(runes []rune) [2]uint64 {
+	var pairs [2]uint64
+	var seen uint64
+	for _, r := range runes {
+		b := uint32(r) % 64
+		for s := seen; s != 0; s &= s - 1 {
+			a := uint32(bits.TrailingZeros64(s))
+			h := (a<<6 | b) * 2654435761 >> 25
+			pairs[h>>6] |= 1 << (h & 63)
+		}
+		seen |= 1 << b
+	}
+	return pairs
+}
+
+// maxMatchScore 返回 pattern 可能取得的最高分：每个字符都连续匹配，heads 中的字符在单词开头。
+// heads 为出现在单词开头的字符的掩码，不在其中的字符没有位置加分；为全 1 时是所有文本中的最高分。
+func maxMatchScore(heads uint64, pattern []rune) int {
+	if len(pattern) == 0 {
+		return 0
+	}
+	score := scoreMatch
+	if heads&runeMask(pattern[0]) != 0 {
+		score += bonusBoundary * bonusFirstCharMultiplier
+	}
+	for _, r := range pattern[1:] {
+		score += scoreMatch + bonusConsecutive
+		if heads&runeMask(r) != 0 {
+			score += max(bonusBoundary, bonusConsecutive) + bonusBoundary - bonusConsecutive
+		}
+	}
+	return score
+}
+
+// fuzzyMatcher 模糊匹配器，复用缓冲区，不能在多个 goroutine 中同时使用。
+//
+// 计分是在所有子序列匹配中求最高分的动态规划。只有 pattern[i] 所在的位置才可能得分，
+// 所以只对这些位置计算：先用从前往后和从后往前的贪心匹配确定每个字符可能的位置范围，
+// 再依次计算 pattern[i] 落在每个位置时的最高分。
+type fuzzyMatcher struct {
+	lo, hi []int   // pattern[i] 可能的位置范围
+	starts []int   // pattern[i] 的候选位置在 pos 中的起始下标
+	pos    []int   // 候选位置
+	scores []int   // pattern[:i+1] 匹配且 pattern[i] 落在该位置时的最高分
+	from   []int32 // 取得最高分时 pattern[i-1] 的候选下标
+}
+
+// score 返回 pattern 在 text 中的最高分，pattern 需要已转为小写
+func (fm *fuzzyMatcher) score(pattern []rune, text *fuzzyText) (int, bool) {
+	score, _, ok := fm.run(pattern, text)
+	return score, ok
+}
+
+// match 返回 pattern 在 text 中的最高分和匹配的字节范围
+func (fm *fuzzyMatcher) match(pattern []rune, text *fuzzyText) (int, []Range, bool) {
+	score, end, ok := fm.run(pattern, text)
+	if !ok || len(pattern) == 0 {
+		return score, nil, ok
+	}
+	positions := make([]int, len(pattern))
+	for i, k := len(pattern)-1, end; i >= 0; i-- {
+		positions[i] = fm.pos[k]
+		k = int(fm.from[k])
+	}
+	return score, text.ranges(positions), true
+}
+
+// run 计算最高分，返回 pattern 最后一个字符的候选下标，用于回溯匹配位置
+func (fm *fuzzyMatcher) run(pattern []rune, text *fuzzyText) (int, int, bool) {
+	m, n := len(pattern), len(text.runes)
+	if m == 0 {
+		return 0, 0, true
+	}
+	if m > n {
+		return 0, 0, false
+	}
+	runes, bonus := text.runes, text.bonus
+
+	// 贪心匹配确定位置范围，同时判断是否为子序列
+	fm.lo, fm.hi = fm.lo[:0], fm.hi[:0]
+	j := 0
+	for i := 0; i < m; i++ {
+		for j < n && runes[j] != pattern[i] {
+			j++
+		}
+		if j == n {
+			return 0, 0, false
+		}
+		fm.lo = append(fm.lo, j)
+		fm.hi = append(fm.hi, 0)
+		j++
+	}
+	j = n - 1
+	for i := m - 1; i >= 0; i-- {
+		for runes[j] != pattern[i] {
+			j--
+		}
+		fm.hi[i] = j
+		j--
+	}
+
+	fm.starts, fm.pos, fm.scores, fm.from = fm.starts[:0], fm.pos[:0], fm.scores[:0], fm.from[:0]
+	for i := 0; i < m; i++ {
+		fm.starts = append(fm.starts, len(fm.pos))
+		prevStart, prevEnd := 0, 0
+		if i > 0 {
+			prevStart, prevEnd = fm.starts[i-1], fm.starts[i]
+		}
+
+		for j := fm.lo[i]; j <= fm.hi[i]; j++ {
+			if runes[j] != pattern[i] {
+				continue
+			}
+			b := int(bonus[j])
+			if i == 0 {
+				fm.pos = append(fm.pos, j)
+				fm.scores = append(fm.scores, scoreMatch+b*bonusFirstCharMultiplier)
+				fm.from = append(fm.from, -1)
+				continue
+			}
+
+			// 连续匹配有加分，跳过字符扣分：跳过 g 个字符扣 scoreGapStart + (g-1)*scoreGapExtension
+			best, from := 0, -1
+			for k := prevStart; k < prevEnd && fm.pos[k] < j; k++ {
+				var s int
+				if gap := j - fm.pos[k] - 1; gap == 0 {
+					s = fm.scores[k] + max(b, bonusConsecutive)
+				} else {
+					s = fm.scores[k] - scoreGapStart - (gap-1)*scoreGapExtension
+				}
+				if from < 0 || s > best || s == best && fm.pos[k] == j-1 {
+					best, from = s, k
+				}
+			}
+			if from < 0 {
+				continue
+			}
+			fm.pos = append(fm.pos, j)
+			fm.scores = append(fm.scores, best+scoreMatch+b)
+			fm.from = append(fm.from, int32(from))
+		}
+	}
+
+	best, end := 0, -1
+	for k := fm.starts[m-1]; k < len(fm.pos); k++ {
+		if end < 0 || fm.scores[k] > best {
+			best, end = fm.scores[k], k
+		}
+	}
+	if end < 0 {
+		return 0, 0, false
+	}
+	return best, end, true
+}
+
+// exactScore 查找 pattern 在 text 中的连续出现，按与模糊匹配相同的规则计分，返回最高分和出现的位置
+func exactScore(pattern []rune, text *fuzzyText) (int, int, bool) {
+	m, n := len(pattern), len(text.runes)
+	if m == 0 {
+		return 0, 0, true
+	}
+
+	best, at := 0, -1
+	for j := 0; j+m <= n; j++ {
+		if text.runes[j] != pattern[0] || !runesHasPrefix(text.runes[j:], pattern) {
+			continue
+		}
+		score := scoreMatch + int(text.bonus[j])*bonusFirstCharMultiplier
+		for k := j + 1; k < j+m; k++ {
+			b := int(text.bonus[k])
+			score += max(b, bonusConsecutive) + scoreMatch + b
+		}
+		if at < 0 || score > best {
+			best, at = score, j
+		}
+	}
+	return best, at, at >= 0
+}
+
+// exactMatch 返回 pattern 在 text 中连续出现的最高分和字节范围
+func exactMatch(pattern []rune, text *fuzzyText) (int, []Range, bool) {
+	score, at, ok := exactScore(pattern, text)
+	if !ok || len(pattern) == 0 {
+		return score, nil, ok
+	}
+	positions := make([]int, len(pattern))
+	for i := range positions {
+		positions[i] = at + i
+	}
+	return score, text.ranges(positions), true
+}
+
+// ranges 返回匹配位置在原文中的字节范围，相邻或对应同一个原文字符的位置合并为一个范围
+func (t *fuzzyText) ranges(positions []int) []Range {
+	var ranges []Range
+	for _, j := range positions {
+		start, end := int(t.starts[j]), int(t.ends[j])
+		if n := len(ranges); n > 0 && ranges[n-1].End >= start {
+			ranges[n-1].End = max(ranges[n-1].End, end)
+			continue
+		}
+		ranges = append(ranges, Range{Start: start, End: end})
+	}
+	return ranges
+}
+
+func runesHasPrefix(s, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubsequence 快速判断 pattern 是否为 text 的子序列
+func isSubsequence(pattern, text []rune) bool {
+	i := 0
+	for _, r := range text {
+		if r == pattern[i] {
+			i++
+			if i == len(pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lowerRunes 返回小写的字符序列
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
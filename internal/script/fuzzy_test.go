@@ -0,0 +1,113 @@
+package script
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyMatchRanges(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    []Range // nil 表示不匹配
+	}{
+		{"bld", "build_tools", []Range{{Start: 0, End: 1}, {Start: 3, End: 5}}},
+		{"bt", "build_tools", []Range{{Start: 0, End: 1}, {Start: 6, End: 7}}},
+		{"bt", "BuildTools", []Range{{Start: 0, End: 1}, {Start: 5, End: 6}}},
+		{"BT", "build tools", []Range{{Start: 0, End: 1}, {Start: 6, End: 7}}},
+		{"tools", "build_tools", []Range{{Start: 6, End: 11}}},
+		// 优先选择在单词开头连续匹配的位置
+		{"ocr", "process_ocr", []Range{{Start: 8, End: 11}}},
+		{"编译", "部署编译工具", []Range{{Start: 6, End: 12}}},
+		{"ab", "b a", nil},
+		{"xyz", "build_tools", nil},
+	}
+	fm := &fuzzyMatcher{}
+	for _, tt := range tests {
+		text := newFuzzyText(tt.text)
+		_, ranges, ok := fm.match(lowerRunes(tt.pattern), &text)
+		if tt.want == nil {
+			if ok {
+				t.Errorf("match(%q, %q) = %v, want no match", tt.pattern, tt.text, ranges)
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(ranges, tt.want) {
+			t.Errorf("match(%q, %q) = %v, %v, want %v", tt.pattern, tt.text, ranges, ok, tt.want)
+		}
+	}
+}
+
+func TestFuzzyScoreOrder(t *testing.T) {
+	// 每组中前一个文本的分数应高于后一个
+	tests := []struct {
+		pattern       string
+		better, worse string
+	}{
+		{"bt", "build_tools", "abstract"},
+		{"build", "build.py", "rebuild.py"},
+		{"ocr", "ocr_tool", "process_docr"},
+	}
+	fm := &fuzzyMatcher{}
+	for _, tt := range tests {
+		pattern := lowerRunes(tt.pattern)
+		better, worse := newFuzzyText(tt.better), newFuzzyText(tt.worse)
+		sb, okb := fm.score(pattern, &better)
+		sw, okw := fm.score(pattern, &worse)
+		if !okb || !okw || sb <= sw {
+			t.Errorf("%q: score(%q) = %d, score(%q) = %d, want the first higher", tt.pattern, tt.better, sb, tt.worse, sw)
+		}
+		if sb > maxMatchScore(^uint64(0), pattern) {
+			t.Errorf("%q: score %d above maxMatchScore", tt.pattern, sb)
+		}
+	}
+}
+
+func TestExactMatchRanges(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    []Range
+	}{
+		{"backend-proto", "deploy backend-proto now", []Range{{Start: 7, End: 20}}},
+		{"tools", "tools_build_tools", []Range{{Start: 0, End: 5}}},
+		{"bld", "build", nil},
+	}
+	for _, tt := range tests {
+		text := newFuzzyText(tt.text)
+		_, ranges, ok := exactMatch(lowerRunes(tt.pattern), &text)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(ranges, tt.want) {
+			t.Errorf("exactMatch(%q, %q) = %v, %v, want %v", tt.pattern, tt.text, ranges, ok, tt.want)
+		}
+	}
+}
+
+func TestSearchMatchedRanges(t *testing.T) {
+	m := newTestManager(t)
+	m.replaceCatalog([]Script{
+		{ID: "build", Name: "build_tools", Path: "build.py", Description: "编译工具", Tags: []string{"ci", "tools"}},
+	}, nil)
+
+	tests := []struct {
+		query string
+		want  []Range
+	}{
+		{"bt", []Range{{FieldName, 0, 1}, {FieldName, 6, 7}}},
+		// 只返回得分最高的字段中的范围
+		{"tools", []Range{{FieldName, 6, 11}}},
+		{"by", []Range{{FieldDescription, 0, 6}}},
+		{`"build_" ci`, []Range{{FieldName, 0, 6}, {FieldTags, 0, 2}}},
+	}
+	for _, tt := range tests {
+		results, err := m.Search(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("Search(%q) returned %d results", tt.query, len(results))
+		}
+		if got := results[0].MatchedRanges; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) ranges = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
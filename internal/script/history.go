@@ -0,0 +1,385 @@
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yahao333/x-script/internal/utils"
+)
+
+// 查询运行历史时默认返回的记录数
+const defaultHistoryLimit = 50
+
+// 每追加若干条记录清理一次过期的运行历史
+const historyPruneInterval = 100
+
+// 运行的触发来源
+const (
+	TriggerGUI = "gui"
+	TriggerCLI = "cli"
+	TriggerAPI = "api"
+)
+
+// HistoryRecord 一次运行的历史记录
+type HistoryRecord struct {
+	RunID      string            `json:"run_id"`
+	ScriptID   string            `json:"script_id,omitempty"`
+	ScriptName string            `json:"script_name"`
+	ScriptPath string            `json:"script_path"`
+	Params     map[string]string `json:"params,omitempty"` // secret 参数已脱敏
+	Trigger    string            `json:"trigger"`
+	State      RunState          `json:"state"`
+	ExitCode   int               `json:"exit_code"`
+	Signal     string            `json:"signal,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	StartTime  time.Time         `json:"start_time"`
+	EndTime    time.Time         `json:"end_time"`
+	Duration   time.Duration     `json:"duration"`
+	OutputFile string            `json:"output_file,omitempty"` // 完整输出的文件路径
+}
+
+// HistoryQuery 运行历史的查询条件，零值表示不限制
+type HistoryQuery struct {
+	Script string     // 脚本 ID 或名称，完全匹配
+	States []RunState // 任一状态匹配即可
+	Since  time.Time  // 开始时间不早于 Since
+	Until  time.Time  // 开始时间早于 Until
+	Text   string     // 在脚本名称、参数、错误信息和输出中查找，不区分大小写
+	Offset int
+	Limit  int // 为 0 时使用默认值
+}
+
+// HistoryPage 一页查询结果，记录按开始时间从新到旧排列
+type HistoryPage struct {
+	Records []HistoryRecord `json:"records"`
+	Total   int             `json:"total"` // 满足条件的记录总数
+}
+
+// History 保存在应用数据目录下的只追加运行历史，按条数和时间清理旧记录及其输出
+type History struct {
+	mu        sync.Mutex
+	dir       string
+	outputDir string
+
+	maxRecords int           // 保留的最多记录数，0 表示不限制
+	maxAge     time.Duration // 保留的最长时间，0 表示不限制
+	appended   int           // 上次清理后追加的记录数
+}
+
+// HistoryOption 运行历史的选项
+type HistoryOption func(*History)
+
+// WithRetention 只保留最近的 maxRecords 条记录和 maxAge 内开始的记录，为 0 时不限制
+func WithRetention(maxRecords int, maxAge time.Duration) HistoryOption {
+	return func(h *History) {
+		h.maxRecords = maxRecords
+		h.maxAge = maxAge
+	}
+}
+
+// NewHistory 创建运行历史，记录写入 dir/runs.jsonl，输出写入 dir/output
+func NewHistory(dir string, opts ...HistoryOption) *History {
+	h := &History{
+		dir:       dir,
+		outputDir: filepath.Join(dir, "output"),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *History) recordsPath() string {
+	return filepath.Join(h.dir, "runs.jsonl")
+}
+
+// OutputPath 返回运行输出文件的路径
+func (h *History) OutputPath(runID string) string {
+	return filepath.Join(h.outputDir, runID+".log")
+}
+
+// createOutput 创建运行输出文件
+func (h *History) createOutput(runID string) (*os.File, error) {
+	if err := os.MkdirAll(h.outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("create history output directory failed: %w", err)
+	}
+	return os.OpenFile(h.OutputPath(runID), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+}
+
+// Append 追加一条运行记录
+func (h *History) Append(record HistoryRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal history record failed: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		return fmt.Errorf("create history directory failed: %w", err)
+	}
+	file, err := os.OpenFile(h.recordsPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open history file failed: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write history record failed: %w", err)
+	}
+	if h.appended++; h.appended >= historyPruneInterval {
+		return h.pruneLocked(time.Now())
+	}
+	return nil
+}
+
+// Prune 删除超出保留条数或时间的记录及其输出文件
+func (h *History) Prune() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pruneLocked(time.Now())
+}
+
+func (h *History) pruneLocked(now time.Time) error {
+	h.appended = 0
+	if h.maxRecords <= 0 && h.maxAge <= 0 {
+		return nil
+	}
+	var cutoff time.Time
+	if h.maxAge > 0 {
+		cutoff = now.Add(-h.maxAge)
+	}
+	expired := func(record HistoryRecord) bool {
+		return !cutoff.IsZero() && record.StartTime.Before(cutoff)
+	}
+
+	// 第一遍统计未过期的记录数，第二遍跳过最旧的多余记录
+	kept := 0
+	err := h.scan(func(record HistoryRecord, _ []byte) bool {
+		if !expired(record) {
+			kept++
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	skip := 0
+	if h.maxRecords > 0 && kept > h.maxRecords {
+		skip = kept - h.maxRecords
+	}
+
+	var out bytes.Buffer
+	var removed []HistoryRecord
+	err = h.scan(func(record HistoryRecord, line []byte) bool {
+		if expired(record) {
+			removed = append(removed, record)
+		} else if skip > 0 {
+			skip--
+			removed = append(removed, record)
+		} else {
+			out.Write(line)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(removed) > 0 {
+		if err := utils.WriteFileAtomic(h.recordsPath(), out.Bytes(), 0644); err != nil {
+			return fmt.Errorf("write history file failed: %w", err)
+		}
+		for _, record := range removed {
+			os.Remove(h.OutputPath(record.RunID))
+		}
+	}
+	// 没有记录的输出文件（例如进程中途退出）按修改时间清理
+	if !cutoff.IsZero() {
+		entries, _ := os.ReadDir(h.outputDir)
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(h.outputDir, entry.Name()))
+			}
+		}
+	}
+	return nil
+}
+
+// Query 按条件查询运行历史，逐条读取文件，只在内存中保留分页需要的记录
+func (h *History) Query(q HistoryQuery) (*HistoryPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	offset := max(q.Offset, 0)
+
+	// 文件按写入顺序保存，最后 offset+limit 条满足条件的记录即为所需的一页
+	window := make([]HistoryRecord, offset+limit)
+	page := &HistoryPage{Records: []HistoryRecord{}}
+	err := h.scan(func(record HistoryRecord, _ []byte) bool {
+		if h.match(record, q) {
+			window[page.Total%len(window)] = record
+			page.Total++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 从新到旧取出跳过 offset 条之后的记录
+	for i := page.Total - 1 - offset; i >= 0 && i >= page.Total-offset-limit; i-- {
+		page.Records = append(page.Records, window[i%len(window)])
+	}
+	return page, nil
+}
+
+// Output 返回运行的完整输出
+func (h *History) Output(runID string) ([]byte, error) {
+	return os.ReadFile(h.OutputPath(runID))
+}
+
+// scan 按写入顺序逐条读取记录，跳过无法解析的行，fn 返回 false 时停止。
+// line 是记录在文件中的原始内容，包括换行符。
+func (h *History) scan(fn func(record HistoryRecord, line []byte) bool) error {
+	file, err := os.Open(h.recordsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open history file failed: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record HistoryRecord
+			if json.Unmarshal(line, &record) == nil {
+				if len(line) > 0 && line[len(line)-1] != '\n' {
+					line = append(line, '\n')
+				}
+				if !fn(record, line) {
+					return nil
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read history file failed: %w", err)
+		}
+	}
+}
+
+// rekey 把脚本 ID 为 from 的记录改为 to，重写整个文件，无法解析的行原样保留
+func (h *History) rekey(from, to string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, err := os.ReadFile(h.recordsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read history file failed: %w", err)
+	}
+
+	var out bytes.Buffer
+	changed := false
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		var record HistoryRecord
+		if json.Unmarshal(line, &record) == nil && record.ScriptID == from {
+			record.ScriptID = to
+			if line, err = json.Marshal(record); err != nil {
+				return fmt.Errorf("marshal history record failed: %w", err)
+			}
+			line = append(line, '\n')
+			changed = true
+		}
+		out.Write(line)
+	}
+	if !changed {
+		return nil
+	}
+	if err := utils.WriteFileAtomic(h.recordsPath(), out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("write history file failed: %w", err)
+	}
+	return nil
+}
+
+// match 判断记录是否满足查询条件
+func (h *History) match(record HistoryRecord, q HistoryQuery) bool {
+	if q.Script != "" && record.ScriptID != q.Script && record.ScriptName != q.Script {
+		return false
+	}
+	if len(q.States) > 0 {
+		found := false
+		for _, state := range q.States {
+			if record.State == state {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !q.Since.IsZero() && record.StartTime.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !record.StartTime.Before(q.Until) {
+		return false
+	}
+	if q.Text != "" {
+		return h.matchText(record, strings.ToLower(q.Text))
+	}
+	return true
+}
+
+// matchText 先匹配记录本身的字段，再查找输出文件
+func (h *History) matchText(record HistoryRecord, text string) bool {
+	fields := []string{record.ScriptName, record.ScriptPath, record.Trigger, record.Error}
+	for _, value := range record.Params {
+		fields = append(fields, value)
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+
+	if record.OutputFile == "" {
+		return false
+	}
+	file, err := os.Open(record.OutputFile)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	// 逐行查找，不把整个输出读入内存；查询文本不含换行，不会跨行匹配
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if bytes.Contains(bytes.ToLower(line), []byte(text)) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
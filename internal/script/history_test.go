@@ -0,0 +1,124 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// appendRuns 追加 n 条运行记录，第 i 条在 start 之后 i 分钟开始，并写入输出文件
+func appendRuns(t *testing.T, h *History, start time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("r%d", i)
+		file, err := h.createOutput(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(file, "output of %s\n", id)
+		file.Close()
+
+		state := RunSucceeded
+		if i%2 == 1 {
+			state = RunFailed
+		}
+		record := HistoryRecord{
+			RunID:      id,
+			ScriptID:   "build",
+			ScriptName: "Build",
+			State:      state,
+			StartTime:  start.Add(time.Duration(i) * time.Minute),
+			OutputFile: h.OutputPath(id),
+		}
+		if err := h.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func runIDs(records []HistoryRecord) []string {
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.RunID
+	}
+	return ids
+}
+
+func TestHistoryQueryPages(t *testing.T) {
+	h := NewHistory(t.TempDir())
+	appendRuns(t, h, time.Now().Add(-time.Hour), 7)
+
+	tests := []struct {
+		query HistoryQuery
+		want  []string
+		total int
+	}{
+		{HistoryQuery{Limit: 3}, []string{"r6", "r5", "r4"}, 7},
+		{HistoryQuery{Offset: 5, Limit: 3}, []string{"r1", "r0"}, 7},
+		{HistoryQuery{Offset: 9}, []string{}, 7},
+		{HistoryQuery{States: []RunState{RunFailed}, Limit: 2}, []string{"r5", "r3"}, 3},
+		{HistoryQuery{Text: "OUTPUT OF R2"}, []string{"r2"}, 1},
+	}
+	for _, tt := range tests {
+		page, err := h.Query(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := runIDs(page.Records); !reflect.DeepEqual(got, tt.want) || page.Total != tt.total {
+			t.Errorf("Query(%+v) = %v (total %d), want %v (total %d)", tt.query, got, page.Total, tt.want, tt.total)
+		}
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	h := NewHistory(t.TempDir(), WithRetention(3, 24*time.Hour))
+	// r0、r1 超过保留时间，r2 超出保留条数
+	appendRuns(t, h, time.Now().Add(-24*time.Hour-2*time.Minute), 6)
+	if err := h.Prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := h.Query(HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := runIDs(page.Records), []string{"r5", "r4", "r3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records after prune = %v, want %v", got, want)
+	}
+	for i := 0; i < 6; i++ {
+		_, err := os.Stat(h.OutputPath(fmt.Sprintf("r%d", i)))
+		if exists := err == nil; exists != (i >= 3) {
+			t.Errorf("output of r%d exists = %v after prune", i, exists)
+		}
+	}
+}
+
+func TestAbortedRunRecordsState(t *testing.T) {
+	m := newTestManager(t)
+	m.replaceCatalog([]Script{
+		{ID: "a", Name: "a", Path: "a.py", Params: []Param{{Name: "p", Required: true}}},
+	}, nil)
+	script, _ := m.GetScript("a")
+
+	// 参数错误在启动进程前失败，同样记入运行历史和脚本状态
+	if _, err := m.ExecuteContext(context.Background(), script, nil); err == nil {
+		t.Fatal("ExecuteContext() without required param succeeded")
+	}
+	got, _ := m.GetScript("a")
+	if got.State.LastStatus != RunFailed || got.State.RunCount != 1 || got.State.FailCount != 1 {
+		t.Errorf("state after aborted run = %+v, want one failed run", got.State)
+	}
+	if got.State.LastRunTime.IsZero() {
+		t.Error("aborted run has no last run time")
+	}
+	page, err := m.History().Query(HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Records[0].State != RunFailed {
+		t.Errorf("history after aborted run = %+v, want one failed run", page.Records)
+	}
+}
@@ -0,0 +1,189 @@
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/yahao333/x-script/pkg/config"
+)
+
+// 内置解释器名称
+const (
+	InterpreterPython = "python"
+	InterpreterExec   = "exec"
+)
+
+// Interpreter 解析后的解释器
+type Interpreter struct {
+	Name string
+	config.InterpreterProfile
+}
+
+// builtinInterpreters 返回内置解释器，python 使用 PythonPath 配置
+func (m *Manager) builtinInterpreters() map[string]config.InterpreterProfile {
+	return map[string]config.InterpreterProfile{
+		InterpreterPython: {
+			Command:    m.config.PythonPath,
+			Args:       []string{"-u"},
+			Env:        map[string]string{"PYTHONIOENCODING": "utf-8"},
+			Extensions: []string{".py", ".pyw"},
+		},
+		"bash": {
+			Command:    "bash",
+			Extensions: []string{".sh"},
+		},
+		"node": {
+			Command:    "node",
+			Extensions: []string{".js", ".mjs", ".cjs"},
+		},
+		"pwsh": {
+			Command:    "pwsh",
+			Args:       []string{"-NoLogo", "-NoProfile", "-File"},
+			Extensions: []string{".ps1"},
+		},
+		"go": {
+			Command:    "go",
+			Args:       []string{"run"},
+			Extensions: []string{".go"},
+		},
+		InterpreterExec: {
+			Extensions: []string{".exe", ".bat", ".cmd"},
+		},
+	}
+}
+
+// pythonCommand 返回脚本实际使用的 Python 命令，interpreters 中的 python 优先于 python_path
+func pythonCommand(cfg *config.AppConfig) string {
+	if profile, ok := cfg.Interpreters[InterpreterPython]; ok {
+		return profile.Command
+	}
+	return cfg.PythonPath
+}
+
+// interpreterProfiles 返回内置解释器和配置中的解释器，配置优先
+func (m *Manager) interpreterProfiles() map[string]config.InterpreterProfile {
+	profiles := m.builtinInterpreters()
+	for name, profile := range m.config.Interpreters {
+		profiles[name] = profile
+	}
+	return profiles
+}
+
+// resolveInterpreter 确定脚本使用的解释器。
+// 依次使用脚本指定的解释器、扩展名匹配、shebang，都没有时可执行文件直接执行，其余按 Python 脚本处理。
+func (m *Manager) resolveInterpreter(script Script) (Interpreter, error) {
+	profiles := m.interpreterProfiles()
+
+	if script.Interpreter != "" {
+		profile, ok := profiles[script.Interpreter]
+		if !ok {
+			return Interpreter{}, fmt.Errorf("unknown interpreter %q", script.Interpreter)
+		}
+		return Interpreter{Name: script.Interpreter, InterpreterProfile: profile}, nil
+	}
+
+	if ext := strings.ToLower(filepath.Ext(script.Path)); ext != "" {
+		// 配置中的解释器优先于内置解释器，同类中按名称排序保证结果稳定
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			_, ci := m.config.Interpreters[names[i]]
+			_, cj := m.config.Interpreters[names[j]]
+			if ci != cj {
+				return ci
+			}
+			return names[i] < names[j]
+		})
+		for _, name := range names {
+			for _, e := range profiles[name].Extensions {
+				if strings.ToLower(e) == ext {
+					return Interpreter{Name: name, InterpreterProfile: profiles[name]}, nil
+				}
+			}
+		}
+	}
+
+	scriptPath := filepath.Join(m.config.ScriptsDir, script.Path)
+	if interp, ok := shebangInterpreter(scriptPath, profiles); ok {
+		return interp, nil
+	}
+
+	if isExecutable(scriptPath) {
+		return Interpreter{Name: InterpreterExec, InterpreterProfile: profiles[InterpreterExec]}, nil
+	}
+	return Interpreter{Name: InterpreterPython, InterpreterProfile: profiles[InterpreterPython]}, nil
+}
+
+// shebangInterpreter 根据脚本首行的 #! 确定解释器。
+// 命令名与某个解释器同名（忽略版本号）时使用该解释器，否则直接使用 shebang 中的命令。
+func shebangInterpreter(path string, profiles map[string]config.InterpreterProfile) (Interpreter, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Interpreter{}, false
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		return Interpreter{}, false
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return Interpreter{}, false
+	}
+
+	fields := strings.Fields(strings.TrimSpace(line[2:]))
+	if len(fields) == 0 {
+		return Interpreter{}, false
+	}
+	// #!/usr/bin/env python3 -> python3
+	if filepath.Base(fields[0]) == "env" {
+		fields = fields[1:]
+		if len(fields) > 0 && fields[0] == "-S" {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return Interpreter{}, false
+		}
+	}
+
+	command := filepath.Base(fields[0])
+	name := strings.TrimRight(strings.TrimSuffix(command, ".exe"), "0123456789.")
+	if profile, ok := profiles[name]; ok {
+		return Interpreter{Name: name, InterpreterProfile: profile}, true
+	}
+
+	// Windows 下 shebang 中的绝对路径通常不存在，只使用命令名
+	if runtime.GOOS == "windows" {
+		fields[0] = command
+	}
+	return Interpreter{
+		Name: command,
+		InterpreterProfile: config.InterpreterProfile{
+			Command: fields[0],
+			Args:    fields[1:],
+		},
+	}, true
+}
+
+// isExecutable 判断文件是否可以直接执行
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".exe", ".com", ".bat", ".cmd":
+			return true
+		}
+		return false
+	}
+	return info.Mode()&0111 != 0
+}
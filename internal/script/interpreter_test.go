@@ -0,0 +1,170 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/yahao333/x-script/pkg/config"
+)
+
+func TestResolveInterpreter(t *testing.T) {
+	m := newTestManager(t)
+	files := map[string]string{
+		"build.py":     "print('hi')\n",
+		"BUILD.PY":     "print('hi')\n",
+		"deploy.sh":    "echo hi\n",
+		"env-python":   "#!/usr/bin/env python3\nprint('hi')\n",
+		"bash-flags":   "#!/bin/bash -e\necho hi\n",
+		"env-split":    "#!/usr/bin/env -S ruby -w\nputs 'hi'\n",
+		"perl-path":    "#!/usr/local/bin/perl -w\nprint 'hi'\n",
+		"python-exe":   "#!C:/Python39/python.exe\nprint('hi')\n",
+		"env-only":     "#!/usr/bin/env\n",
+		"plain":        "print('hi')\n",
+		"shebang-late": "\n#!/bin/bash\n",
+	}
+	for name, content := range files {
+		writeScriptFile(t, m, name, content)
+	}
+
+	tests := []struct {
+		name        string
+		script      Script
+		wantName    string
+		wantCommand string
+		wantArgs    []string
+	}{
+		{"extension", Script{Path: "build.py"}, InterpreterPython, "python", []string{"-u"}},
+		{"extension ignores case", Script{Path: "BUILD.PY"}, InterpreterPython, "python", []string{"-u"}},
+		{"shell extension", Script{Path: "deploy.sh"}, "bash", "bash", nil},
+		{"explicit interpreter", Script{Path: "build.py", Interpreter: "node"}, "node", "node", nil},
+		{"shebang env with version", Script{Path: "env-python"}, InterpreterPython, "python", []string{"-u"}},
+		{"shebang known interpreter", Script{Path: "bash-flags"}, "bash", "bash", nil},
+		{"shebang env -S", Script{Path: "env-split"}, "ruby", "ruby", []string{"-w"}},
+		{"shebang windows python", Script{Path: "python-exe"}, InterpreterPython, "python", []string{"-u"}},
+		{"shebang env without command", Script{Path: "env-only"}, InterpreterPython, "python", []string{"-u"}},
+		{"no extension or shebang", Script{Path: "plain"}, InterpreterPython, "python", []string{"-u"}},
+		{"shebang must be first line", Script{Path: "shebang-late"}, InterpreterPython, "python", []string{"-u"}},
+		{"missing file", Script{Path: "missing"}, InterpreterPython, "python", []string{"-u"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interp, err := m.resolveInterpreter(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if interp.Name != tt.wantName || interp.Command != tt.wantCommand || !reflect.DeepEqual(interp.Args, tt.wantArgs) {
+				t.Errorf("got %s (%q %q), want %s (%q %q)",
+					interp.Name, interp.Command, interp.Args, tt.wantName, tt.wantCommand, tt.wantArgs)
+			}
+		})
+	}
+
+	t.Run("shebang unknown command", func(t *testing.T) {
+		interp, err := m.resolveInterpreter(Script{Path: "perl-path"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantCommand := "/usr/local/bin/perl"
+		if runtime.GOOS == "windows" {
+			wantCommand = "perl"
+		}
+		if interp.Name != "perl" || interp.Command != wantCommand || !reflect.DeepEqual(interp.Args, []string{"-w"}) {
+			t.Errorf("got %s (%q %q)", interp.Name, interp.Command, interp.Args)
+		}
+	})
+
+	t.Run("unknown explicit interpreter", func(t *testing.T) {
+		if _, err := m.resolveInterpreter(Script{Path: "build.py", Interpreter: "cobol"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestResolveInterpreterExecutable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable bit is not used on windows")
+	}
+	m := newTestManager(t)
+	path := writeScriptFile(t, m, "tool", "\x7fELF")
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	interp, err := m.resolveInterpreter(Script{Path: "tool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interp.Name != InterpreterExec || interp.Command != "" {
+		t.Errorf("got %s (%q), want direct execution", interp.Name, interp.Command)
+	}
+}
+
+func TestResolveInterpreterConfigured(t *testing.T) {
+	m := newTestManager(t)
+	m.config.Interpreters = map[string]config.InterpreterProfile{
+		// 配置的解释器优先于内置解释器，同名时覆盖内置配置
+		"py3":  {Command: "python3", Extensions: []string{".PY"}},
+		"bash": {Command: "/bin/bash", Args: []string{"--norc"}},
+	}
+	writeScriptFile(t, m, "bash-flags", "#!/bin/bash -e\necho hi\n")
+
+	tests := []struct {
+		script      Script
+		wantName    string
+		wantCommand string
+	}{
+		{Script{Path: "build.py"}, "py3", "python3"},
+		// 覆盖后的 bash 没有扩展名，.sh 不再匹配任何解释器，按 Python 处理
+		{Script{Path: "deploy.sh"}, InterpreterPython, "python"},
+		{Script{Path: "bash-flags"}, "bash", "/bin/bash"},
+	}
+	for _, tt := range tests {
+		interp, err := m.resolveInterpreter(tt.script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if interp.Name != tt.wantName || interp.Command != tt.wantCommand {
+			t.Errorf("%s: got %s (%q), want %s (%q)", tt.script.Path, interp.Name, interp.Command, tt.wantName, tt.wantCommand)
+		}
+	}
+}
+
+func TestDiscoverPythonConfiguredProfile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses executable permission bits")
+	}
+	dir := t.TempDir()
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("PYENV_ROOT", t.TempDir())
+	profile := filepath.Join(dir, "profile-python")
+	pythonPath := filepath.Join(dir, "python-path")
+	for _, path := range []string{profile, pythonPath} {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.DefaultConfig
+	cfg.ScriptsDir = t.TempDir()
+	cfg.PythonPath = pythonPath
+	cfg.Interpreters = map[string]config.InterpreterProfile{
+		InterpreterPython: {Command: profile},
+	}
+
+	// interpreters 中的 python 才是配置的解释器，被覆盖的 python_path 仍作为候选
+	var got []InterpreterInfo
+	for _, info := range discoverPython(&cfg) {
+		if info.Path == profile || info.Path == pythonPath {
+			got = append(got, info)
+		}
+	}
+	want := []InterpreterInfo{
+		{Path: profile, Source: SourceConfig},
+		{Path: pythonPath, Source: SourcePythonPath},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverPython() = %+v, want %+v", got, want)
+	}
+}
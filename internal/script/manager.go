@@ -1,45 +1,106 @@
 package script
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/yahao333/x-script/internal/utils"
 	"github.com/yahao333/x-script/pkg/config"
 	"github.com/yahao333/x-script/pkg/logger"
 )
 
-// 添加一个回调函数类型
-type OutputCallback func(string)
 type Script struct {
-	Name        string    `json:"name"`
-	Path        string    `json:"path"`
-	Description string    `json:"description"`
-	Keywords    string    `json:"keywords"`
-	LastRunTime time.Time `json:"last_run_time"`
+	ID             string `json:"id,omitempty"` // 为空时根据 Path 生成，用于运行状态和历史记录
+	Name           string `json:"name"`
+	Path           string `json:"path"`
+	Description    string `json:"description"`
+	OutputEncoding string `json:"output_encoding,omitempty"` // 为空时使用全局配置
+
+	// 标签和分类，用于分组显示和过滤；旧版本逗号分隔的 keywords 加载时转换为标签
+	Tags     []string `json:"tags,omitempty"`
+	Category string   `json:"category,omitempty"` // 用 "/" 分隔层级，如 "dev/build"
+
+	// 执行配置，同一个脚本文件可以用不同的参数注册为多个条目
+	Interpreter string            `json:"interpreter,omitempty"` // 解释器名称，为空时根据扩展名或 shebang 推断
+	Args        []string          `json:"args,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`         // 值支持 ${VAR} 引用
+	Cwd         string            `json:"cwd,omitempty"`         // 工作目录，相对路径基于 ScriptsDir
+	InheritEnv  *bool             `json:"inherit_env,omitempty"` // 是否继承 x-script 的环境变量，默认继承
+	Params      []Param           `json:"params,omitempty"`      // 运行时由用户填写的参数
+	// 依赖，声明后在独立的虚拟环境中运行
+	Requirements *Requirements `json:"requirements,omitempty"`
+
+	// 运行时状态，来自应用数据目录下的状态文件
+	State ScriptState `json:"-"`
+	// 是否由扫描 ScriptsDir 自动登记，而不是来自 scripts.json
+	Discovered bool `json:"-"`
 }
 
 type Manager struct {
 	config  *config.AppConfig
 	logger  *logger.Logger
-	scripts []Script
+	dataDir string
+
+	// catalog 是脚本目录的当前快照，读取时不加锁；mu 保证修改依次进行
+	mu      sync.Mutex
+	catalog atomic.Pointer[Snapshot]
+
+	// catalogMu 保证对 scripts.json 的修改和重新加载依次进行，
+	// 从读取文件到替换脚本目录都持有，先开始的加载不会覆盖后完成的修改
+	catalogMu   sync.Mutex
+	subscribers subscribers
+	index       *searchIndex
+	runs        *registry
+	history     *History
+	state       *stateStore
+	venvLocks   venvLocks
+
+	// pinMu 保证置顶顺序的修改依次进行
+	pinMu sync.Mutex
+
+	// pruneOnce 保证启动后只清理一次过期的虚拟环境和运行历史
+	pruneOnce sync.Once
 }
 
 func NewManager(cfg *config.AppConfig, log *logger.Logger) *Manager {
-	return &Manager{
+	dataDir := utils.GetAppDataDir()
+	retention := time.Duration(cfg.HistoryMaxDays) * 24 * time.Hour
+	m := &Manager{
 		config:  cfg,
 		logger:  log,
-		scripts: make([]Script, 0),
+		dataDir: dataDir,
+		runs:    newRegistry(),
+		history: NewHistory(filepath.Join(dataDir, "history"), WithRetention(cfg.HistoryMaxRecords, retention)),
+		state:   newStateStore(statePath(dataDir)),
 	}
+	m.index = newSearchIndex(m.rankingLess, m.rankingBoost)
+	m.catalog.Store(newSnapshot(0, nil, nil))
+	return m
+}
+
+// History 返回运行历史
+func (m *Manager) History() *History {
+	return m.history
 }
 
 func (m *Manager) Load() error {
+	m.catalogMu.Lock()
+	defer m.catalogMu.Unlock()
+	return m.loadLocked()
+}
+
+// loadLocked 读取 scripts.json 和运行时状态并替换脚本目录，调用方需持有 catalogMu
+func (m *Manager) loadLocked() error {
 	m.logger.WithFields(logger.Fields{
 		"scriptsDir": m.config.ScriptsDir,
 	}).Debug("Loading scripts")
@@ -48,163 +109,407 @@ func (m *Manager) Load() error {
 	configPath := filepath.Join(m.config.ScriptsDir, "scripts.json")
 
 	data, err := os.ReadFile(configPath)
-	if err != nil {
+	if errors.Is(err, os.ErrNotExist) && m.config.AutoDiscover {
+		// 开启自动发现时可以不提供 scripts.json
+		data = []byte(`{"scripts": []}`)
+	} else if err != nil {
 		return fmt.Errorf("read scripts config failed: %w", err)
 	}
 
-	var config struct {
-		Scripts []Script `json:"scripts"`
+	if _, err := parseOutputEncoding(m.config.OutputEncoding); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
 	}
-	if err := json.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("parse scripts config failed: %w", err)
+	if _, err := parseRanking(m.config.Ranking); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
 	}
 
-	m.scripts = config.Scripts
-	m.logger.WithField("count", len(m.scripts)).Info("Scripts loaded")
-	return nil
-}
+	// scripts.json 由用户维护，只读取不写回
+	entries, diags, err := parseCatalog(data)
+	if err != nil {
+		return fmt.Errorf("parse scripts config failed: %w", err)
+	}
+	if m.config.AutoDiscover {
+		discovered, discoverDiags := m.discoverScripts(entries)
+		entries = append(entries, discovered...)
+		diags = append(diags, discoverDiags...)
+	}
 
-func (m *Manager) Search(keyword string) []Script {
-	m.logger.WithFields(logger.Fields{
-		"keyword": keyword,
-	}).Debug("Searching scripts")
-
-	var results []Script
-	if keyword == "" {
-		// 复制所有脚本
-		results = make([]Script, len(m.scripts))
-		copy(results, m.scripts)
-	} else {
-		// 搜索匹配的脚本
-		keyword = strings.ToLower(keyword)
-		for _, script := range m.scripts {
-			if strings.Contains(strings.ToLower(script.Name), keyword) ||
-				strings.Contains(strings.ToLower(script.Keywords), keyword) {
-				results = append(results, script)
-			}
-		}
+	if err := m.state.load(); err != nil {
+		m.logger.WithError(err).Warn("Failed to load script state, starting with empty state")
 	}
 
-	// 按最后运行时间排序
-	sort.Slice(results, func(i, j int) bool {
-		// 如果两个脚本都没有运行过（零值），按名称排序
-		if results[i].LastRunTime.IsZero() && results[j].LastRunTime.IsZero() {
-			return results[i].Name < results[j].Name
+	scripts, validateDiags := m.validateCatalog(entries)
+	diags = append(diags, validateDiags...)
+	// 旧版本按脚本名称保存的状态只在加载时迁移，检查条目时不迁移
+	if err := m.state.migrateNames(scripts); err != nil {
+		m.logger.WithError(err).Warn("Failed to save migrated script state")
+	}
+	// scripts.json 中的条目在前，自动发现的脚本在后
+	sort.SliceStable(diags, func(i, j int) bool {
+		if (diags[i].Index < 0) != (diags[j].Index < 0) {
+			return diags[j].Index < 0
 		}
-		// 未运行过的脚本放在后面
-		if results[i].LastRunTime.IsZero() {
-			return false
+		if diags[i].Index != diags[j].Index {
+			return diags[i].Index < diags[j].Index
 		}
-		if results[j].LastRunTime.IsZero() {
-			return true
+		return diags[i].File < diags[j].File
+	})
+	for _, d := range diags {
+		entry := m.logger.WithFields(logger.Fields{
+			"index":  d.Index,
+			"file":   d.File,
+			"id":     d.ScriptID,
+			"field":  d.Field,
+			"reason": d.Message,
+		})
+		if d.Severity == SeverityError {
+			entry.Error("Invalid script entry skipped")
+		} else {
+			entry.Warn("Script entry has problems")
 		}
-		// 按最后运行时间降序排序（最近的在前面）
-		return results[i].LastRunTime.After(results[j].LastRunTime)
+	}
+
+	m.replaceCatalog(scripts, diags)
+	m.logger.WithFields(logger.Fields{
+		"count":       len(scripts),
+		"diagnostics": len(diags),
+	}).Info("Scripts loaded")
+
+	m.pruneOnce.Do(func() {
+		go m.pruneVenvs()
+		go m.pruneHistory()
 	})
+	return nil
+}
 
-	return results
+// Execute 执行脚本并等待其结束。
+// 脚本启动失败时 RunResult 为 nil；脚本运行失败时同时返回 RunResult 和 RunResult.Err。
+func (m *Manager) Execute(script Script, callback OutputCallback) (*RunResult, error) {
+	run, err := m.ExecuteContext(context.Background(), script, LineCallback(callback))
+	if err != nil {
+		return nil, err
+	}
+	return run.Wait()
 }
 
-func (m *Manager) Execute(script Script, callback OutputCallback) error {
+// ExecuteContext 启动脚本并立即返回运行句柄。
+// 声明了依赖的脚本在后台准备虚拟环境后启动，准备失败的错误记录在运行结果中。
+// ctx 取消或调用 Run.Stop 时，先中断脚本进程组，等待超时后强制结束；Windows 界面没有控制台，直接结束。
+func (m *Manager) ExecuteContext(ctx context.Context, script Script, handler OutputHandler, opts ...RunOption) (*Run, error) {
+	options := runOptions{
+		gracePeriod: time.Duration(m.config.StopGracePeriod) * time.Second,
+		trigger:     TriggerAPI,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	// 调用方自行构造的脚本没有 ID，按 Load 的规则生成
+	if script.ID == "" {
+		script.ID = deriveID(script.Path)
+	}
+
+	run := newRun(script, m.logger, options)
+	m.runs.add(run)
+
+	// 完整输出保存到运行历史中
+	if file, err := m.history.createOutput(run.id); err != nil {
+		m.logger.WithError(err).Warn("Failed to create run output file")
+	} else {
+		run.outputFile = file
+	}
+
+	// 校验参数，所有错误一起返回
+	params, err := ResolveParams(script, options.params)
+	if err != nil {
+		return nil, m.abort(run, err)
+	}
+	run.params = params.Redacted()
+
 	m.logger.WithFields(logger.Fields{
+		"runID":      run.id,
+		"scriptID":   script.ID,
 		"scriptName": script.Name,
 		"scriptPath": script.Path,
+		"params":     params.Redacted(),
 	}).Info("Executing script")
 
+	// 脚本未指定编码时使用全局配置
+	encodingName := script.OutputEncoding
+	if encodingName == "" {
+		encodingName = m.config.OutputEncoding
+	}
+	enc, err := parseOutputEncoding(encodingName)
+	if err != nil {
+		return nil, m.abort(run, err)
+	}
+
+	interp, err := m.resolveInterpreter(script)
+	if err != nil {
+		return nil, m.abort(run, err)
+	}
+
+	if script.Requirements.Empty() {
+		if err := m.start(ctx, run, interp, params, enc, handler); err != nil {
+			return nil, err
+		}
+		return run, nil
+	}
+
+	// 声明了依赖的 Python 脚本使用独立的虚拟环境。
+	// 准备在后台进行，期间运行处于排队状态，调用方可以立即拿到 Run 并停止它
+	if !isPythonInterpreter(interp) {
+		return nil, m.abort(run, fmt.Errorf("requirements are only supported for python scripts, got interpreter %q", interp.Name))
+	}
+	go m.setupAndStart(ctx, run, interp, params, enc, handler)
+	return run, nil
+}
+
+// setupAndStart 准备虚拟环境后启动脚本，ctx 取消或调用 Run.Stop 时中止准备
+func (m *Manager) setupAndStart(ctx context.Context, run *Run, interp Interpreter, params *ResolvedParams, enc outputEncoding, handler OutputHandler) {
+	setupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-run.stopCh:
+			cancel()
+		case <-setupCtx.Done():
+		}
+	}()
+
+	python, err := m.ensureVenv(setupCtx, run.script, interp.Command, func(line string) {
+		run.emitSystem(line, handler)
+	})
+	if setupCtx.Err() != nil {
+		run.stopped.Store(true)
+		m.abort(run, fmt.Errorf("%w during environment setup", ErrRunCancelled))
+		return
+	}
+	if err != nil {
+		m.abort(run, err)
+		return
+	}
+	interp.Command = python
+	// 启动失败时错误已记录在运行结果中
+	m.start(ctx, run, interp, params, enc, handler)
+}
+
+// start 启动脚本进程，并在后台监督进程和读取输出；失败时结束运行并返回错误
+func (m *Manager) start(ctx context.Context, run *Run, interp Interpreter, params *ResolvedParams, enc outputEncoding, handler OutputHandler) error {
+	script := run.script
+
 	// 创建命令
-	cmd := exec.Command(m.config.PythonPath, filepath.Join(m.config.ScriptsDir, script.Path))
+	cmd, err := m.buildCommand(script, interp, params)
+	if err != nil {
+		return m.abort(run, err)
+	}
+	prepareProcessGroup(cmd)
+	m.logger.WithFields(logger.Fields{
+		"runID":       run.id,
+		"interpreter": interp.Name,
+		"command":     cmd.Path,
+	}).Debug("Script command resolved")
 
-	// 创建管道获取输出
-	stdout, err := cmd.StdoutPipe()
+	// 创建管道获取输出，父进程只保留读端
+	stdoutReader, stdoutWriter, err := os.Pipe()
 	if err != nil {
-		return fmt.Errorf("create stdout pipe failed: %w", err)
+		return m.abort(run, fmt.Errorf("create stdout pipe failed: %w", err))
 	}
-	stderr, err := cmd.StderrPipe()
+	stderrReader, stderrWriter, err := os.Pipe()
 	if err != nil {
-		return fmt.Errorf("create stderr pipe failed: %w", err)
+		stdoutReader.Close()
+		stdoutWriter.Close()
+		return m.abort(run, fmt.Errorf("create stderr pipe failed: %w", err))
 	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
 
 	// 启动命令
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("start script failed: %w", err)
+	err = cmd.Start()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	if err != nil {
+		stdoutReader.Close()
+		stderrReader.Close()
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			err = fmt.Errorf("interpreter %q for %s not found, check python_path or interpreters in config: %w", interp.Name, script.Name, err)
+		}
+		return m.abort(run, fmt.Errorf("start script failed: %w", err))
 	}
 
+	group, err := newProcessGroup(cmd)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to track script process group")
+	}
+	run.started(cmd, group)
+	m.publish(Event{Type: EventRunStarted, ScriptID: script.ID, RunID: run.id, State: RunRunning})
+
+	go run.supervise(ctx.Done())
+	go m.collect(run, enc, stdoutReader, stderrReader, handler)
+	return nil
+}
+
+// collect 读取脚本输出，等待进程结束并完成收尾工作
+func (m *Manager) collect(run *Run, enc outputEncoding, stdout, stderr *os.File, handler OutputHandler) {
+	defer close(run.done)
+	defer run.group.close()
+
 	// 创建一个通道来接收输出
-	outputChan := make(chan string)
+	outputChan := make(chan OutputEvent)
+	quit := make(chan struct{})
+
+	// 输出在到达回调和日志之前统一转换为 UTF-8
+	readLines := func(r io.Reader, stream Stream) {
+		decoder := newOutputDecoder(enc, r)
+		readOutput(decoder, func(kind OutputKind, data []byte) bool {
+			now := time.Now()
+			event := OutputEvent{
+				RunID:  run.id,
+				Stream: stream,
+				Kind:   kind,
+				Time:   now,
+				Offset: now.Sub(run.startTime),
+				Data:   append([]byte(nil), decoder.decode(data, kind == OutputLine)...),
+			}
+			select {
+			case outputChan <- event:
+				return true
+			case <-quit:
+				return false
+			}
+		})
+	}
 
+	var readers sync.WaitGroup
+	readers.Add(2)
 	// 处理标准输出
 	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			outputChan <- scanner.Text()
-		}
+		defer readers.Done()
+		readLines(countingReader{stdout, &run.stdoutBytes}, StreamStdout)
 	}()
-
 	// 处理标准错误
 	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			outputChan <- "ERROR: " + scanner.Text()
-		}
+		defer readers.Done()
+		readLines(countingReader{stderr, &run.stderrBytes}, StreamStderr)
+	}()
+	go func() {
+		readers.Wait()
+		close(run.drained)
 	}()
 
-	// 等待命令完成
+	// 等待命令完成，再等待输出读取完毕。
+	// 读取超时后读取协程可能仍在发送，outputChan 不关闭，结束信息通过 finished 单独传递，
+	// 之后读取协程的发送因 quit 已关闭而放弃
+	var waitErr error
+	finished := make(chan OutputEvent, 1)
 	go func() {
-		err := cmd.Wait()
-		if err != nil {
-			outputChan <- fmt.Sprintf("Script execution failed: %v", err)
-		} else {
-			outputChan <- fmt.Sprintf("Script '%s' completed successfully", script.Name)
+		waitErr = run.cmd.Wait()
+		close(run.exited)
+
+		select {
+		case <-run.drained:
+		case <-time.After(outputDrainTimeout):
+			m.logger.WithField("scriptName", run.script.Name).Warn("Script output still open after exit, detaching")
+			close(quit)
+			stdout.Close()
+			stderr.Close()
 		}
-		close(outputChan)
+
+		var message string
+		switch {
+		case run.Stopped():
+			message = fmt.Sprintf("Script '%s' stopped", run.script.Name)
+		case waitErr != nil:
+			message = fmt.Sprintf("Script execution failed: %v", waitErr)
+		default:
+			message = fmt.Sprintf("Script '%s' completed successfully", run.script.Name)
+		}
+		finished <- run.systemEvent(message)
 	}()
 
-	// 修改输出处理部分
-	for output := range outputChan {
-		// 记录到日志
-		m.logger.Info(output)
+	handle := func(event OutputEvent) {
+		event.Seq = run.nextSeq()
+		run.appendOutput(event)
+		// 记录到日志，不完整行和进度更新只在结束成行时记录
+		if event.Kind == OutputLine {
+			m.logger.WithFields(logger.Fields{
+				"runID":  run.id,
+				"stream": event.Stream,
+			}).Info(event.Text())
+		}
 		// 调用回调函数处理输出
-		if callback != nil {
-			callback(output)
+		if handler != nil {
+			handler(event)
 		}
 	}
-
-	// 更新最后运行时间
-	for i := range m.scripts {
-		if m.scripts[i].Name == script.Name {
-			m.scripts[i].LastRunTime = time.Now()
-			// 保存到文件
-			if err := m.saveScripts(); err != nil {
-				m.logger.WithError(err).Error("Failed to save scripts")
-			}
-			break
+	for done := false; !done; {
+		select {
+		case event := <-outputChan:
+			handle(event)
+		case event := <-finished:
+			handle(event)
+			done = true
 		}
 	}
+	stdout.Close()
+	stderr.Close()
 
-	return nil
+	result := newRunResult(run, run.cmd.ProcessState, waitErr)
+	run.finish(result)
+	m.finished(run)
+	m.logger.WithFields(logger.Fields{
+		"runID":       run.id,
+		"scriptName":  run.script.Name,
+		"exitCode":    result.ExitCode,
+		"duration":    result.Duration,
+		"stdoutBytes": result.StdoutBytes,
+		"stderrBytes": result.StderrBytes,
+	}).Info("Script finished")
 }
 
-// 添加保存脚本配置的函数
-func (m *Manager) saveScripts() error {
-	config := struct {
-		Scripts []Script `json:"scripts"`
-	}{
-		Scripts: m.scripts,
-	}
+// abort 在脚本进程启动前结束运行，与正常结束的运行一样记录
+func (m *Manager) abort(run *Run, err error) error {
+	run.abort(err)
+	m.finished(run)
+	return err
+}
 
-	data, err := json.MarshalIndent(config, "", "    ")
-	if err != nil {
-		return fmt.Errorf("marshal scripts config failed: %w", err)
-	}
+// finished 把已结束的运行记入运行历史和脚本状态，并发出运行结束事件
+func (m *Manager) finished(run *Run) {
+	info := run.Info()
+	m.recordRun(run)
+	m.recordResult(run.script, info.State, info.Result)
+	m.publish(Event{Type: EventRunFinished, ScriptID: run.script.ID, RunID: run.id, State: info.State, Err: info.Result.Err})
+}
 
-	configPath := filepath.Join(m.config.ScriptsDir, "scripts.json")
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
-		return fmt.Errorf("write scripts config failed: %w", err)
+// recordRun 把已结束的运行写入运行历史
+func (m *Manager) recordRun(run *Run) {
+	outputPath := ""
+	if _, err := os.Stat(m.history.OutputPath(run.id)); err == nil {
+		outputPath = m.history.OutputPath(run.id)
+	}
+	if err := m.history.Append(run.historyRecord(outputPath)); err != nil {
+		m.logger.WithError(err).Error("Failed to record run history")
 	}
+}
 
-	return nil
+// pruneHistory 按配置的保留条数和天数清理运行历史
+func (m *Manager) pruneHistory() {
+	if err := m.history.Prune(); err != nil {
+		m.logger.WithError(err).Warn("Failed to prune run history")
+	}
 }
 
+// GetScripts 返回全部脚本的副本
 func (m *Manager) GetScripts() []Script {
-	return m.scripts
+	return m.Snapshot().Scripts()
+}
+
+// GetScript 根据 ID 查找脚本
+func (m *Manager) GetScript(id string) (Script, bool) {
+	return m.Snapshot().Script(id)
+}
+
+// Diagnostics 返回最近一次 Load 发现的问题
+func (m *Manager) Diagnostics() []Diagnostic {
+	return m.Snapshot().Diagnostics()
 }
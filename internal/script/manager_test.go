@@ -0,0 +1,41 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yahao333/x-script/pkg/config"
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+// newTestManager 创建使用临时脚本目录和数据目录的 Manager，不加载脚本
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("AppData", home)
+
+	cfg := config.DefaultConfig
+	cfg.ScriptsDir = t.TempDir()
+	cfg.LogLevel = "error"
+	log, err := logger.New(&cfg, t.TempDir(), logger.WithoutConsole())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(&cfg, log)
+}
+
+// writeScriptFile 在脚本目录中写入文件，返回完整路径
+func writeScriptFile(t *testing.T, m *Manager, name, content string) string {
+	t.Helper()
+	path := filepath.Join(m.config.ScriptsDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
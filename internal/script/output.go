@@ -0,0 +1,86 @@
+package script
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutputCallback 按行接收输出文本的回调，标准错误的行带有 "ERROR: " 前缀
+type OutputCallback func(string)
+
+// OutputHandler 接收结构化输出事件的回调
+type OutputHandler func(OutputEvent)
+
+// Stream 输出来源
+type Stream int
+
+const (
+	StreamStdout Stream = iota // 脚本标准输出
+	StreamStderr               // 脚本标准错误
+	StreamSystem               // x-script 自身产生的状态信息
+)
+
+func (s Stream) String() string {
+	switch s {
+	case StreamStdout:
+		return "stdout"
+	case StreamStderr:
+		return "stderr"
+	case StreamSystem:
+		return "system"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText 以名称形式序列化输出来源
+func (s Stream) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// OutputEvent 一条脚本输出
+type OutputEvent struct {
+	RunID  string
+	Stream Stream
+	Kind   OutputKind
+	Seq    uint64        // 同一次运行内按投递顺序递增的序号
+	Time   time.Time     // 读取到输出的时间，包含单调时钟读数
+	Offset time.Duration // 相对运行开始的单调时间偏移
+	Data   []byte        // 转换为 UTF-8 后的内容，不含行尾换行符
+}
+
+// Text 返回输出内容的字符串形式
+func (e OutputEvent) Text() string {
+	return string(e.Data)
+}
+
+// MarshalJSON 以文本形式序列化输出内容
+func (e OutputEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		RunID  string        `json:"run_id"`
+		Stream Stream        `json:"stream"`
+		Kind   OutputKind    `json:"kind"`
+		Seq    uint64        `json:"seq"`
+		Time   time.Time     `json:"time"`
+		Offset time.Duration `json:"offset"`
+		Text   string        `json:"text"`
+	}{e.RunID, e.Stream, e.Kind, e.Seq, e.Time, e.Offset, e.Text()})
+}
+
+// LineCallback 把按行的字符串回调适配为 OutputHandler，保持旧的输出格式。
+// 只转发完整的行，不完整行和回车更新会被忽略。
+func LineCallback(callback OutputCallback) OutputHandler {
+	if callback == nil {
+		return nil
+	}
+	return func(event OutputEvent) {
+		if event.Kind != OutputLine {
+			return
+		}
+		if event.Stream == StreamStderr {
+			callback("ERROR: " + event.Text())
+			return
+		}
+		callback(event.Text())
+	}
+}
@@ -0,0 +1,298 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParamType 参数类型
+type ParamType string
+
+const (
+	ParamString ParamType = "string"
+	ParamInt    ParamType = "int"
+	ParamBool   ParamType = "bool"
+	ParamEnum   ParamType = "enum"
+	ParamPath   ParamType = "path"
+	ParamSecret ParamType = "secret"
+)
+
+// 脱敏后显示的参数值
+const redactedValue = "******"
+
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Param 脚本声明的输入参数。
+// Flag 和 Env 都未设置时，参数渲染为 --<name> 命令行参数。
+type Param struct {
+	Name        string      `json:"name"`
+	Type        ParamType   `json:"type,omitempty"` // 默认为 string
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Choices     []string    `json:"choices,omitempty"`
+	Pattern     string      `json:"pattern,omitempty"` // 值需要完整匹配的正则表达式
+	Flag        string      `json:"flag,omitempty"`    // 命令行参数名，例如 --output
+	Env         string      `json:"env,omitempty"`     // 环境变量名
+}
+
+// ParamError 单个参数的校验错误
+type ParamError struct {
+	Param   string
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("param %q: %s", e.Param, e.Message)
+}
+
+// ParamErrors 一次解析中的全部参数错误
+type ParamErrors []*ParamError
+
+func (e ParamErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ResolvedParams 校验并渲染后的参数
+type ResolvedParams struct {
+	Values map[string]string // 规范化后的参数值
+	Args   []string          // 追加到脚本参数之后的命令行参数
+	Env    map[string]string // 追加到脚本环境变量中的变量
+
+	secrets map[string]bool
+}
+
+// Redacted 返回隐藏了 secret 参数值的参数表，用于日志和运行记录
+func (r *ResolvedParams) Redacted() map[string]string {
+	if r == nil {
+		return nil
+	}
+	values := make(map[string]string, len(r.Values))
+	for name, value := range r.Values {
+		if r.secrets[name] {
+			value = redactedValue
+		}
+		values[name] = value
+	}
+	return values
+}
+
+// paramType 返回参数类型，未设置时为 string
+func (p Param) paramType() ParamType {
+	if p.Type == "" {
+		return ParamString
+	}
+	return p.Type
+}
+
+// defaultValue 返回默认值的字符串形式
+func (p Param) defaultValue() (string, bool) {
+	switch v := p.Default.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// flag 返回命令行参数名，只设置了 Env 时返回空字符串
+func (p Param) flag() string {
+	if p.Flag == "" && p.Env == "" {
+		return "--" + p.Name
+	}
+	return p.Flag
+}
+
+// validate 检查参数声明本身是否合法
+func (p Param) validate() error {
+	if !paramNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid param name %q", p.Name)
+	}
+
+	switch p.paramType() {
+	case ParamString, ParamInt, ParamBool, ParamPath, ParamSecret:
+	case ParamEnum:
+		if len(p.Choices) == 0 {
+			return &ParamError{Param: p.Name, Message: "enum param requires choices"}
+		}
+	default:
+		return &ParamError{Param: p.Name, Message: fmt.Sprintf("unknown type %q", p.Type)}
+	}
+
+	if p.Pattern != "" {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return &ParamError{Param: p.Name, Message: fmt.Sprintf("invalid pattern: %v", err)}
+		}
+	}
+	if p.Env != "" && strings.ContainsAny(p.Env, "=\x00") {
+		return &ParamError{Param: p.Name, Message: fmt.Sprintf("invalid env name %q", p.Env)}
+	}
+
+	if value, ok := p.defaultValue(); ok {
+		if _, err := p.normalize(value); err != nil {
+			return &ParamError{Param: p.Name, Message: fmt.Sprintf("invalid default: %v", err)}
+		}
+	}
+	return nil
+}
+
+// normalize 按参数类型校验并规范化参数值
+func (p Param) normalize(value string) (string, error) {
+	switch p.paramType() {
+	case ParamInt:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%q is not an integer", value)
+		}
+		value = strconv.Itoa(n)
+	case ParamBool:
+		b, err := parseBool(value)
+		if err != nil {
+			return "", err
+		}
+		value = strconv.FormatBool(b)
+	case ParamPath:
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return "", fmt.Errorf("path is empty")
+		}
+		value = filepath.Clean(expandEnv(value, os.LookupEnv))
+	}
+
+	if len(p.Choices) > 0 && !containsString(p.Choices, value) {
+		return "", fmt.Errorf("%q is not one of %s", value, strings.Join(p.Choices, ", "))
+	}
+	if p.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %v", err)
+		}
+		if !re.MatchString(value) {
+			return "", fmt.Errorf("value does not match pattern %q", p.Pattern)
+		}
+	}
+	return value, nil
+}
+
+// render 把参数值渲染为命令行参数和环境变量
+func (p Param) render(value string, resolved *ResolvedParams) {
+	if flag := p.flag(); flag != "" {
+		if p.paramType() == ParamBool {
+			if value == "true" {
+				resolved.Args = append(resolved.Args, flag)
+			}
+		} else {
+			resolved.Args = append(resolved.Args, flag, value)
+		}
+	}
+	if p.Env != "" {
+		resolved.Env[p.Env] = value
+	}
+}
+
+// ResolveParams 校验用户输入的参数值，补充默认值并渲染为命令行参数和环境变量。
+// 所有错误会一起以 ParamErrors 返回。
+func ResolveParams(script Script, values map[string]string) (*ResolvedParams, error) {
+	resolved := &ResolvedParams{
+		Values:  make(map[string]string),
+		Env:     make(map[string]string),
+		secrets: make(map[string]bool),
+	}
+
+	var errs ParamErrors
+	declared := make(map[string]bool, len(script.Params))
+	for _, param := range script.Params {
+		declared[param.Name] = true
+		if param.paramType() == ParamSecret {
+			resolved.secrets[param.Name] = true
+		}
+
+		value, ok := values[param.Name]
+		if !ok || value == "" {
+			value, ok = param.defaultValue()
+		}
+		if !ok {
+			if param.Required {
+				errs = append(errs, &ParamError{Param: param.Name, Message: "is required"})
+			}
+			continue
+		}
+
+		normalized, err := param.normalize(value)
+		if err != nil {
+			errs = append(errs, &ParamError{Param: param.Name, Message: err.Error()})
+			continue
+		}
+		resolved.Values[param.Name] = normalized
+		param.render(normalized, resolved)
+	}
+
+	// 按名称排序，保证错误信息稳定
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, &ParamError{Param: name, Message: "is not declared by the script"})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return resolved, nil
+}
+
+// parseBool 解析布尔值，除 strconv.ParseBool 支持的形式外还接受 yes/no/on/off
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "y", "on":
+		return true, nil
+	case "no", "n", "off":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, fmt.Errorf("%q is not a boolean", value)
+	}
+	return b, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateParams 检查脚本的参数声明
+func validateParams(params []Param) error {
+	seen := make(map[string]bool, len(params))
+	for _, param := range params {
+		if err := param.validate(); err != nil {
+			return err
+		}
+		if seen[param.Name] {
+			return &ParamError{Param: param.Name, Message: "declared more than once"}
+		}
+		seen[param.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package script
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveParams(t *testing.T) {
+	t.Setenv("XS_TEST_DATA", "/data")
+
+	tests := []struct {
+		name     string
+		params   []Param
+		values   map[string]string
+		wantArgs []string
+		wantEnv  map[string]string
+		wantErr  []string // 每个参数错误中应包含的内容，按出现顺序
+	}{
+		{
+			name:     "string renders as flag",
+			params:   []Param{{Name: "target"}},
+			values:   map[string]string{"target": "release"},
+			wantArgs: []string{"--target", "release"},
+		},
+		{
+			name:     "custom flag and env",
+			params:   []Param{{Name: "out", Flag: "-o", Env: "OUT_DIR"}},
+			values:   map[string]string{"out": "dist"},
+			wantArgs: []string{"-o", "dist"},
+			wantEnv:  map[string]string{"OUT_DIR": "dist"},
+		},
+		{
+			name:    "env only",
+			params:  []Param{{Name: "token", Type: ParamSecret, Env: "TOKEN"}},
+			values:  map[string]string{"token": "s3cret"},
+			wantEnv: map[string]string{"TOKEN": "s3cret"},
+		},
+		{
+			name:     "int is normalized",
+			params:   []Param{{Name: "jobs", Type: ParamInt}},
+			values:   map[string]string{"jobs": " 08 "},
+			wantArgs: []string{"--jobs", "8"},
+		},
+		{
+			name:    "int rejects text",
+			params:  []Param{{Name: "jobs", Type: ParamInt}},
+			values:  map[string]string{"jobs": "four"},
+			wantErr: []string{`param "jobs": "four" is not an integer`},
+		},
+		{
+			name:     "bool true renders flag only",
+			params:   []Param{{Name: "verbose", Type: ParamBool}},
+			values:   map[string]string{"verbose": "yes"},
+			wantArgs: []string{"--verbose"},
+		},
+		{
+			name:    "bool false renders nothing",
+			params:  []Param{{Name: "verbose", Type: ParamBool, Env: "VERBOSE"}},
+			values:  map[string]string{"verbose": "off"},
+			wantEnv: map[string]string{"VERBOSE": "false"},
+		},
+		{
+			name:    "bool rejects text",
+			params:  []Param{{Name: "verbose", Type: ParamBool}},
+			values:  map[string]string{"verbose": "maybe"},
+			wantErr: []string{`"maybe" is not a boolean`},
+		},
+		{
+			name:     "path expands env and cleans",
+			params:   []Param{{Name: "dir", Type: ParamPath}},
+			values:   map[string]string{"dir": "${XS_TEST_DATA}/a/../b"},
+			wantArgs: []string{"--dir", filepath.Join("/data", "b")},
+		},
+		{
+			name:    "path rejects empty value",
+			params:  []Param{{Name: "dir", Type: ParamPath}},
+			values:  map[string]string{"dir": "  "},
+			wantErr: []string{"path is empty"},
+		},
+		{
+			name:    "required",
+			params:  []Param{{Name: "target", Required: true}},
+			wantErr: []string{`param "target": is required`},
+		},
+		{
+			name:    "empty value counts as missing",
+			params:  []Param{{Name: "target", Required: true}},
+			values:  map[string]string{"target": ""},
+			wantErr: []string{"is required"},
+		},
+		{
+			name:     "default used when missing",
+			params:   []Param{{Name: "jobs", Type: ParamInt, Default: float64(4), Required: true}},
+			wantArgs: []string{"--jobs", "4"},
+		},
+		{
+			name:     "value overrides default",
+			params:   []Param{{Name: "target", Default: "debug"}},
+			values:   map[string]string{"target": "release"},
+			wantArgs: []string{"--target", "release"},
+		},
+		{
+			name:   "optional without default is skipped",
+			params: []Param{{Name: "target"}},
+		},
+		{
+			name:     "enum choice",
+			params:   []Param{{Name: "mode", Type: ParamEnum, Choices: []string{"debug", "release"}}},
+			values:   map[string]string{"mode": "release"},
+			wantArgs: []string{"--mode", "release"},
+		},
+		{
+			name:    "enum rejects other values",
+			params:  []Param{{Name: "mode", Type: ParamEnum, Choices: []string{"debug", "release"}}},
+			values:  map[string]string{"mode": "fast"},
+			wantErr: []string{`"fast" is not one of debug, release`},
+		},
+		{
+			name:     "pattern matches whole value",
+			params:   []Param{{Name: "version", Pattern: `\d+\.\d+`}},
+			values:   map[string]string{"version": "1.2"},
+			wantArgs: []string{"--version", "1.2"},
+		},
+		{
+			name:    "pattern rejects partial match",
+			params:  []Param{{Name: "version", Pattern: `\d+\.\d+`}},
+			values:  map[string]string{"version": "1.2-beta"},
+			wantErr: []string{"does not match pattern"},
+		},
+		{
+			name:    "undeclared values",
+			params:  []Param{{Name: "target"}},
+			values:  map[string]string{"b": "1", "a": "2"},
+			wantErr: []string{`param "a": is not declared`, `param "b": is not declared`},
+		},
+		{
+			name: "all errors reported together",
+			params: []Param{
+				{Name: "target", Required: true},
+				{Name: "jobs", Type: ParamInt},
+			},
+			values:  map[string]string{"jobs": "x"},
+			wantErr: []string{`"target": is required`, `"jobs": "x" is not an integer`},
+		},
+		{
+			name: "params rendered in declaration order",
+			params: []Param{
+				{Name: "b"},
+				{Name: "a", Flag: "-a"},
+			},
+			values:   map[string]string{"a": "1", "b": "2"},
+			wantArgs: []string{"--b", "2", "-a", "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := ResolveParams(Script{Params: tt.params}, tt.values)
+			if len(tt.wantErr) > 0 {
+				var errs ParamErrors
+				if !errors.As(err, &errs) {
+					t.Fatalf("got error %v, want ParamErrors", err)
+				}
+				if len(errs) != len(tt.wantErr) {
+					t.Fatalf("got %d errors (%v), want %d", len(errs), err, len(tt.wantErr))
+				}
+				for i, want := range tt.wantErr {
+					if !strings.Contains(errs[i].Error(), want) {
+						t.Errorf("error %d = %q, want it to contain %q", i, errs[i].Error(), want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(resolved.Args, tt.wantArgs) {
+				t.Errorf("args = %q, want %q", resolved.Args, tt.wantArgs)
+			}
+			if tt.wantEnv == nil {
+				tt.wantEnv = map[string]string{}
+			}
+			if !reflect.DeepEqual(resolved.Env, tt.wantEnv) {
+				t.Errorf("env = %v, want %v", resolved.Env, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestResolveParamsRedactsSecrets(t *testing.T) {
+	script := Script{Params: []Param{
+		{Name: "user"},
+		{Name: "password", Type: ParamSecret, Env: "PASSWORD"},
+	}}
+	resolved, err := ResolveParams(script, map[string]string{"user": "admin", "password": "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"user": "admin", "password": redactedValue}
+	if got := resolved.Redacted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Redacted() = %v, want %v", got, want)
+	}
+	if resolved.Env["PASSWORD"] != "s3cret" {
+		t.Errorf("env PASSWORD = %q, want the real value", resolved.Env["PASSWORD"])
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []Param
+		wantErr string
+	}{
+		{"valid", []Param{{Name: "target"}, {Name: "jobs", Type: ParamInt, Default: float64(2)}}, ""},
+		{"invalid name", []Param{{Name: "1st"}}, "invalid param name"},
+		{"unknown type", []Param{{Name: "a", Type: "float"}}, `unknown type "float"`},
+		{"enum without choices", []Param{{Name: "a", Type: ParamEnum}}, "requires choices"},
+		{"invalid pattern", []Param{{Name: "a", Pattern: "("}}, "invalid pattern"},
+		{"invalid env name", []Param{{Name: "a", Env: "A=B"}}, "invalid env name"},
+		{"invalid default", []Param{{Name: "a", Type: ParamInt, Default: "x"}}, "invalid default"},
+		{"default not in choices", []Param{{Name: "a", Choices: []string{"x"}, Default: "y"}}, "invalid default"},
+		{"duplicate", []Param{{Name: "a"}, {Name: "a"}}, "declared more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateParams(tt.params)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package script
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+// PinnedScripts 返回置顶的脚本，按置顶顺序排列
+func (m *Manager) PinnedScripts() []Script {
+	var pinned []Script
+	for _, script := range m.Snapshot().scripts {
+		if script.State.Pinned {
+			pinned = append(pinned, script.clone())
+		}
+	}
+	sort.SliceStable(pinned, func(i, j int) bool {
+		return pinned[i].State.PinOrder < pinned[j].State.PinOrder
+	})
+	return pinned
+}
+
+// SetPinned 置顶或取消置顶脚本，新置顶的脚本排在已置顶脚本的后面
+func (m *Manager) SetPinned(id string, pinned bool) error {
+	m.pinMu.Lock()
+	defer m.pinMu.Unlock()
+
+	script, ok := m.GetScript(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrScriptNotFound, id)
+	}
+	if script.State.Pinned == pinned {
+		return nil
+	}
+	order := 0
+	if pinned {
+		order = 1
+		if scripts := m.PinnedScripts(); len(scripts) > 0 {
+			order = scripts[len(scripts)-1].State.PinOrder + 1
+		}
+	}
+	if err := m.updateState(script, func(s *ScriptState) {
+		s.Pinned = pinned
+		s.PinOrder = order
+	}); err != nil {
+		return err
+	}
+	m.logger.WithFields(logger.Fields{
+		"scriptID": id,
+		"pinned":   pinned,
+	}).Info("Script pin changed")
+	return nil
+}
+
+// MovePinned 把置顶的脚本移动到置顶列表中的 index 位置
+func (m *Manager) MovePinned(id string, index int) error {
+	m.pinMu.Lock()
+	defer m.pinMu.Unlock()
+
+	pinned := m.PinnedScripts()
+	i := -1
+	for k, script := range pinned {
+		if script.ID == id {
+			i = k
+		}
+	}
+	if i < 0 {
+		if _, ok := m.GetScript(id); !ok {
+			return fmt.Errorf("%w: %s", ErrScriptNotFound, id)
+		}
+		return fmt.Errorf("script %q is not pinned", id)
+	}
+	if index < 0 || index >= len(pinned) {
+		return fmt.Errorf("index %d out of range [0, %d)", index, len(pinned))
+	}
+
+	script := pinned[i]
+	pinned = append(pinned[:i], pinned[i+1:]...)
+	pinned = append(pinned[:index], append([]Script{script}, pinned[index:]...)...)
+	// 重新从 1 开始编号，只写入顺序有变化的脚本
+	for k, p := range pinned {
+		if p.State.PinOrder == k+1 {
+			continue
+		}
+		order := k + 1
+		if err := m.updateState(p, func(s *ScriptState) {
+			s.PinOrder = order
+		}); err != nil {
+			return err
+		}
+	}
+	m.logger.WithFields(logger.Fields{
+		"scriptID": id,
+		"index":    index,
+	}).Info("Pinned script moved")
+	return nil
+}
+
+// SetHidden 隐藏或显示脚本，隐藏的脚本不会被删除，只是默认不出现在搜索结果中
+func (m *Manager) SetHidden(id string, hidden bool) error {
+	script, ok := m.GetScript(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrScriptNotFound, id)
+	}
+	if script.State.Hidden == hidden {
+		return nil
+	}
+	if err := m.updateState(script, func(s *ScriptState) {
+		s.Hidden = hidden
+	}); err != nil {
+		return err
+	}
+	m.logger.WithFields(logger.Fields{
+		"scriptID": id,
+		"hidden":   hidden,
+	}).Info("Script visibility changed")
+	return nil
+}
@@ -0,0 +1,112 @@
+package script
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPinAndMove(t *testing.T) {
+	m := newTestManager(t)
+	m.config.Ranking = RankingManual
+	m.replaceCatalog([]Script{
+		{ID: "a", Name: "a", Path: "a.py"},
+		{ID: "b", Name: "b", Path: "b.py"},
+		{ID: "c", Name: "c", Path: "c.py"},
+		{ID: "d", Name: "d", Path: "d.py"},
+	}, nil)
+
+	pinned := func() []string {
+		t.Helper()
+		return scriptIDs(m.PinnedScripts())
+	}
+	searched := func(opts ...SearchOption) []string {
+		t.Helper()
+		results, err := m.Search("", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(results))
+		for i, result := range results {
+			ids[i] = result.Script.ID
+		}
+		return ids
+	}
+
+	for _, id := range []string{"c", "a", "d"} {
+		if err := m.SetPinned(id, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := pinned(), []string{"c", "a", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pinned = %v, want %v", got, want)
+	}
+
+	if err := m.MovePinned("d", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pinned(), []string{"d", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after move pinned = %v, want %v", got, want)
+	}
+	if got, want := searched(), []string{"d", "c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search = %v, want %v", got, want)
+	}
+
+	// 取消置顶后再次置顶，排在最后
+	if err := m.SetPinned("c", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetPinned("c", true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pinned(), []string{"d", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after re-pin pinned = %v, want %v", got, want)
+	}
+
+	if err := m.SetHidden("a", true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := searched(), []string{"d", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search without hidden = %v, want %v", got, want)
+	}
+	if got, want := searched(WithHidden()), []string{"d", "a", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("search with hidden = %v, want %v", got, want)
+	}
+
+	// 状态写入状态文件，重新加载后保留
+	reloaded := newStateStore(statePath(m.dataDir))
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := reloaded.get("a"); !s.Pinned || !s.Hidden || s.PinOrder == 0 {
+		t.Errorf("saved state of a = %+v", s)
+	}
+}
+
+func TestMovePinnedErrors(t *testing.T) {
+	m := newTestManager(t)
+	m.replaceCatalog([]Script{
+		{ID: "a", Name: "a", Path: "a.py"},
+		{ID: "b", Name: "b", Path: "b.py"},
+	}, nil)
+	if err := m.SetPinned("a", true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id    string
+		index int
+	}{
+		{"missing", 0},
+		{"b", 0},
+		{"a", 1},
+		{"a", -1},
+	}
+	for _, tt := range tests {
+		if err := m.MovePinned(tt.id, tt.index); err == nil {
+			t.Errorf("MovePinned(%q, %d): expected an error", tt.id, tt.index)
+		}
+	}
+	if err := m.SetPinned("missing", true); err == nil {
+		t.Error("SetPinned of a missing script: expected an error")
+	}
+}
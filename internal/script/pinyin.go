@@ -0,0 +1,74 @@
+package script
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// pinyinData 汉字拼音表，每行为一个音节及读该音节的汉字
+//
+//go:embed pinyin.txt
+var pinyinData string
+
+var (
+	pinyinOnce  sync.Once
+	pinyinTable map[rune]string
+)
+
+// pinyinOf 返回汉字不带声调的拼音，不在拼音表中的字符返回 false
+func pinyinOf(r rune) (string, bool) {
+	if r < 0x3400 {
+		return "", false
+	}
+	pinyinOnce.Do(loadPinyinTable)
+	syllable, ok := pinyinTable[r]
+	return syllable, ok
+}
+
+func loadPinyinTable() {
+	pinyinTable = make(map[rune]string, 8000)
+	for _, line := range strings.Split(pinyinData, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		syllable, chars, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		for _, r := range chars {
+			pinyinTable[r] = syllable
+		}
+	}
+}
+
+// newPinyinText 把文本中的汉字替换为拼音，例如 "编译scts" 转换为 "bianyiscts"。
+// 每个音节的开头视为单词开头，"bianyi" 和首字母 "by" 都能匹配；文本中没有汉字时返回 false。
+func newPinyinText(s string) (fuzzyText, bool) {
+	var t fuzzyText
+	found := false
+	prev := classDelimiter
+	for i, r := range s {
+		if len(t.runes) >= maxFuzzyText {
+			break
+		}
+		end := i + utf8.RuneLen(r)
+		if syllable, ok := pinyinOf(r); ok {
+			for k, c := range syllable {
+				bonus := 0
+				if k == 0 {
+					bonus = bonusBoundary
+				}
+				t.append(c, bonus, i, end)
+			}
+			found = true
+			prev = classLetter
+			continue
+		}
+		class := classOf(r)
+		t.append(r, bonusFor(prev, class), i, end)
+		prev = class
+	}
+	return t, found
+}
@@ -0,0 +1,68 @@
+package script
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPinyinOf(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want string
+		ok   bool
+	}{
+		{'编', "bian", true},
+		{'译', "yi", true},
+		{'部', "bu", true},
+		{'署', "shu", true},
+		{'a', "", false},
+		{'1', "", false},
+	}
+	for _, tt := range tests {
+		got, ok := pinyinOf(tt.r)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("pinyinOf(%q) = %q, %v, want %q, %v", tt.r, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPinyinMatchRanges(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    []Range // nil 表示不匹配
+	}{
+		{"bianyi", "编译工具", []Range{{Start: 0, End: 6}}},
+		{"by", "编译工具", []Range{{Start: 0, End: 6}}},
+		{"gj", "编译工具", []Range{{Start: 6, End: 12}}},
+		{"bygj", "编译工具", []Range{{Start: 0, End: 12}}},
+		// 拼音中间的字母也能匹配，范围对应整个汉字
+		{"ian", "编译", []Range{{Start: 0, End: 3}}},
+		{"bysc", "编译scts", []Range{{Start: 0, End: 8}}},
+		{"by", "a 编 x 译", []Range{{Start: 2, End: 5}, {Start: 8, End: 11}}},
+		{"bs", "编译", nil},
+	}
+	fm := &fuzzyMatcher{}
+	for _, tt := range tests {
+		text, ok := newPinyinText(tt.text)
+		if !ok {
+			t.Fatalf("newPinyinText(%q) found no Chinese characters", tt.text)
+		}
+		_, ranges, ok := fm.match(lowerRunes(tt.pattern), &text)
+		if tt.want == nil {
+			if ok {
+				t.Errorf("match(%q, %q) = %v, want no match", tt.pattern, tt.text, ranges)
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(ranges, tt.want) {
+			t.Errorf("match(%q, %q) = %v, %v, want %v", tt.pattern, tt.text, ranges, ok, tt.want)
+		}
+	}
+}
+
+func TestPinyinTextWithoutChinese(t *testing.T) {
+	if _, ok := newPinyinText("build_tools"); ok {
+		t.Error("newPinyinText reported Chinese characters in ASCII text")
+	}
+}
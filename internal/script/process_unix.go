@@ -0,0 +1,45 @@
+//go:build !windows
+
+package script
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// processGroup 对应脚本进程所在的进程组，子进程和孙进程默认都在该组内
+type processGroup struct {
+	pgid int
+}
+
+// prepareProcessGroup 让脚本进程以自己为组长启动新的进程组
+func prepareProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// newProcessGroup 在进程启动后获取进程组
+func newProcessGroup(cmd *exec.Cmd) (*processGroup, error) {
+	return &processGroup{pgid: cmd.Process.Pid}, nil
+}
+
+// interrupt 向整个进程组发送 SIGINT
+func (g *processGroup) interrupt() error {
+	return syscall.Kill(-g.pgid, syscall.SIGINT)
+}
+
+// kill 强制结束整个进程组
+func (g *processGroup) kill() error {
+	return syscall.Kill(-g.pgid, syscall.SIGKILL)
+}
+
+func (g *processGroup) close() {}
+
+// exitSignal 返回结束进程的信号名称，正常退出时返回空字符串
+func exitSignal(state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	return status.Signal().String()
+}
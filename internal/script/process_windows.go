@@ -0,0 +1,137 @@
+//go:build windows
+
+package script
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetConsoleWindow = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetConsoleWindow")
+
+// processGroup 使用 Job Object 跟踪脚本进程及其派生的所有子进程。
+// Job Object 不设置 KILL_ON_JOB_CLOSE，脚本正常退出后，它启动的服务、编辑器等进程继续运行；
+// 只有停止脚本时才结束其中的全部进程。
+type processGroup struct {
+	pid int
+	job windows.Handle
+}
+
+// prepareProcessGroup 让脚本进程在新的控制台进程组中挂起启动，
+// 加入 Job Object 后再恢复运行，保证它派生的子进程都在 Job Object 中
+func prepareProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: windows.CREATE_NEW_PROCESS_GROUP | windows.CREATE_SUSPENDED,
+	}
+}
+
+// newProcessGroup 创建 Job Object，把挂起的脚本进程加入其中后恢复运行。
+// 创建失败时也会恢复进程，只是停止时无法结束它派生的子进程。
+func newProcessGroup(cmd *exec.Cmd) (*processGroup, error) {
+	g := &processGroup{pid: cmd.Process.Pid}
+	job, err := assignJob(g.pid)
+	if resumeErr := resumeProcess(g.pid); resumeErr != nil {
+		if job != 0 {
+			windows.TerminateJobObject(job, 1)
+			windows.CloseHandle(job)
+		} else {
+			cmd.Process.Kill()
+		}
+		return g, fmt.Errorf("resume process failed: %w", resumeErr)
+	}
+	g.job = job
+	return g, err
+}
+
+// assignJob 创建 Job Object 并把进程加入其中
+func assignJob(pid int) (windows.Handle, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return 0, fmt.Errorf("create job object failed: %w", err)
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return 0, fmt.Errorf("open process failed: %w", err)
+	}
+	defer windows.CloseHandle(process)
+
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return 0, fmt.Errorf("assign process to job object failed: %w", err)
+	}
+	return job, nil
+}
+
+// resumeProcess 恢复挂起启动的进程，新进程只有一个主线程
+func resumeProcess(pid int) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	resumed := false
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != uint32(pid) {
+			continue
+		}
+		thread, openErr := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if openErr != nil {
+			return openErr
+		}
+		_, resumeErr := windows.ResumeThread(thread)
+		windows.CloseHandle(thread)
+		if resumeErr != nil {
+			return resumeErr
+		}
+		resumed = true
+	}
+	if !resumed {
+		return fmt.Errorf("no thread found for process %d", pid)
+	}
+	return nil
+}
+
+// interrupt 向脚本所在的进程组发送 CTRL_BREAK。
+// CTRL_BREAK 只能发给同一控制台中的进程，以 windowsgui 方式运行的界面没有控制台，
+// 此时返回 errInterruptUnsupported，停止脚本直接结束进程组；命令行模式连接了控制台时可以中断。
+func (g *processGroup) interrupt() error {
+	if hwnd, _, _ := procGetConsoleWindow.Call(); hwnd == 0 {
+		return errInterruptUnsupported
+	}
+	return windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(g.pid))
+}
+
+// kill 结束 Job Object 中的全部进程，Job Object 不可用时只结束脚本进程
+func (g *processGroup) kill() error {
+	if g.job != 0 {
+		return windows.TerminateJobObject(g.job, 1)
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, uint32(g.pid))
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(process)
+	return windows.TerminateProcess(process, 1)
+}
+
+// close 关闭 Job Object 句柄，其中仍在运行的进程不受影响
+func (g *processGroup) close() {
+	if g.job != 0 {
+		windows.CloseHandle(g.job)
+		g.job = 0
+	}
+}
+
+// exitSignal Windows 下进程不会被信号结束，始终返回空字符串
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
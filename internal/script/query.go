@@ -0,0 +1,334 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 查询中支持的过滤条件
+const (
+	FilterTag      = "tag"      // 标签，忽略大小写完全匹配
+	FilterCategory = "category" // 分类及其子分类，如 dev 匹配 dev/build
+	FilterLang     = "lang"     // 扩展名或解释器名称，如 py、python
+	FilterStatus   = "status"   // 最后一次运行的状态，never 表示没有运行过
+	FilterRan      = "ran"      // 最后一次运行的时间，如 <7d 表示 7 天内运行过
+	FilterPath     = "path"     // 路径包含的文本
+)
+
+// StatusNever 表示没有运行过，用于 status 过滤条件
+const StatusNever = "never"
+
+var filterNames = []string{FilterTag, FilterCategory, FilterLang, FilterStatus, FilterRan, FilterPath}
+
+// Expr 查询语法树的节点
+type Expr interface {
+	// Span 返回节点在查询中的字节范围 [start, end)
+	Span() (start, end int)
+}
+
+// AndExpr 所有条件都需要满足
+type AndExpr struct {
+	Operands []Expr
+}
+
+// NotExpr 排除满足条件的脚本，写作 -tag:demo 或 -word
+type NotExpr struct {
+	Operand Expr
+	Start   int
+}
+
+// TextExpr 自由文本。普通词模糊匹配，引号中的短语需要连续出现
+type TextExpr struct {
+	Text       string
+	Phrase     bool
+	Start, End int
+
+	pattern  []rune
+	mask     uint64
+	pairs    [2]uint64
+	maxScore int
+}
+
+// FilterExpr 字段过滤条件，写作 field:value，ran 的值可以带比较符号
+type FilterExpr struct {
+	Field      string
+	Op         string // ran 的比较符号：<、<=、>、>=，Value 中保留原文
+	Value      string
+	Start, End int
+
+	duration time.Duration
+}
+
+func (e *AndExpr) Span() (int, int) {
+	start, _ := e.Operands[0].Span()
+	_, end := e.Operands[len(e.Operands)-1].Span()
+	return start, end
+}
+
+func (e *NotExpr) Span() (int, int) {
+	_, end := e.Operand.Span()
+	return e.Start, end
+}
+
+func (e *TextExpr) Span() (int, int)   { return e.Start, e.End }
+func (e *FilterExpr) Span() (int, int) { return e.Start, e.End }
+
+// Query 解析后的查询，Expr 为 nil 时匹配所有脚本
+type Query struct {
+	Raw  string
+	Expr Expr
+}
+
+// QueryError 查询中的一处语法错误，Start 和 End 为出错部分在查询中的字节位置
+type QueryError struct {
+	Start, End int
+	Message    string
+}
+
+// SyntaxError 查询语法错误
+type SyntaxError struct {
+	Query  string
+	Errors []QueryError
+}
+
+func (e *SyntaxError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, qe := range e.Errors {
+		messages[i] = fmt.Sprintf("%s at position %d", qe.Message, qe.Start)
+	}
+	return "invalid query: " + strings.Join(messages, "; ")
+}
+
+// ParseQuery 解析搜索查询。
+// 查询由空白分隔的条件组成，条件之间是“且”的关系：
+//
+//	build tools       模糊匹配名称、标签、分类和描述
+//	"build tools"     短语，需要连续出现
+//	tag:build         标签
+//	category:dev      分类，包括 dev/build 等子分类
+//	lang:py           扩展名或解释器
+//	status:failed     最后一次运行的状态
+//	ran:<7d           最后一次运行的时间，单位支持 m、h、d、w
+//	path:ocr          路径
+//	-tag:demo         在条件前加 - 表示排除
+//
+// 不是过滤条件名称的前缀按普通文本匹配，如 http:、c:。
+// 语法错误时返回 *SyntaxError，包含每处错误的位置。
+func ParseQuery(query string) (*Query, error) {
+	p := &queryParser{src: query}
+	var operands []Expr
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			break
+		}
+		if expr := p.parseClause(); expr != nil {
+			operands = append(operands, expr)
+		}
+	}
+	if len(p.errs) > 0 {
+		return nil, &SyntaxError{Query: query, Errors: p.errs}
+	}
+
+	q := &Query{Raw: query}
+	switch len(operands) {
+	case 0:
+	case 1:
+		q.Expr = operands[0]
+	default:
+		q.Expr = &AndExpr{Operands: operands}
+	}
+	return q, nil
+}
+
+type queryParser struct {
+	src  string
+	pos  int
+	errs []QueryError
+}
+
+func (p *queryParser) errorf(start, end int, format string, args ...interface{}) {
+	p.errs = append(p.errs, QueryError{Start: start, End: end, Message: fmt.Sprintf(format, args...)})
+}
+
+func isQuerySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && isQuerySpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// word 读取到下一个空白为止的文本
+func (p *queryParser) word() string {
+	start := p.pos
+	for p.pos < len(p.src) && !isQuerySpace(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// quoted 读取引号中的文本，p.pos 指向左引号
+func (p *queryParser) quoted() (string, bool) {
+	start := p.pos
+	end := strings.IndexByte(p.src[start+1:], '"')
+	if end < 0 {
+		p.pos = len(p.src)
+		p.errorf(start, p.pos, "unterminated quote")
+		return "", false
+	}
+	p.pos = start + 1 + end + 1
+	return p.src[start+1 : start+1+end], true
+}
+
+// parseClause 解析一个条件，出错时记录错误并跳过该条件
+func (p *queryParser) parseClause() Expr {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+		if p.pos >= len(p.src) || isQuerySpace(p.src[p.pos]) {
+			p.errorf(start, p.pos, "missing term after '-'")
+			return nil
+		}
+		operand := p.parseClause()
+		if operand == nil {
+			return nil
+		}
+		return &NotExpr{Operand: operand, Start: start}
+	}
+
+	if p.src[p.pos] == '"' {
+		text, ok := p.quoted()
+		if !ok {
+			return nil
+		}
+		if strings.TrimSpace(text) == "" {
+			p.errorf(start, p.pos, "empty phrase")
+			return nil
+		}
+		return newTextExpr(text, true, start, p.pos)
+	}
+
+	// 过滤条件名称后面紧跟冒号的是过滤条件，其他带冒号的词（如 http:、c:）按普通文本匹配
+	i := p.pos
+	for i < len(p.src) && isASCIILetter(p.src[i]) {
+		i++
+	}
+	if i > p.pos && i < len(p.src) && p.src[i] == ':' && isFilterName(strings.ToLower(p.src[p.pos:i])) {
+		field := strings.ToLower(p.src[p.pos:i])
+		p.pos = i + 1
+		return p.parseFilter(start, field)
+	}
+
+	text := p.word()
+	return newTextExpr(text, false, start, p.pos)
+}
+
+func newTextExpr(text string, phrase bool, start, end int) *TextExpr {
+	pattern := lowerRunes(text)
+	return &TextExpr{
+		Text:     text,
+		Phrase:   phrase,
+		Start:    start,
+		End:      end,
+		pattern:  pattern,
+		mask:     patternMask(pattern),
+		pairs:    pairMask(pattern),
+		maxScore: maxMatchScore(^uint64(0), pattern),
+	}
+}
+
+func isFilterName(field string) bool {
+	for _, name := range filterNames {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (p *queryParser) parseFilter(start int, field string) Expr {
+	valueStart := p.pos
+	var value string
+	if p.pos < len(p.src) && p.src[p.pos] == '"' {
+		var ok bool
+		if value, ok = p.quoted(); !ok {
+			return nil
+		}
+	} else {
+		value = p.word()
+	}
+	expr := &FilterExpr{Field: field, Value: value, Start: start, End: p.pos}
+
+	if strings.TrimSpace(value) == "" {
+		p.errorf(start, p.pos, "missing value for %s", field)
+		return nil
+	}
+
+	switch field {
+	case FilterCategory:
+		expr.Value = normalizeCategory(value)
+		if expr.Value == "" {
+			p.errorf(start, p.pos, "missing value for %s", field)
+			return nil
+		}
+	case FilterStatus:
+		expr.Value = strings.ToLower(value)
+		switch RunState(expr.Value) {
+		case RunSucceeded, RunFailed, RunCancelled, StatusNever:
+		default:
+			p.errorf(valueStart, p.pos, "unknown status %q, expected one of %s, %s, %s, %s",
+				value, RunSucceeded, RunFailed, RunCancelled, StatusNever)
+			return nil
+		}
+	case FilterRan:
+		op, d, err := parseRanValue(value)
+		if err != nil {
+			p.errorf(valueStart, p.pos, "%v", err)
+			return nil
+		}
+		expr.Op, expr.duration = op, d
+	}
+	return expr
+}
+
+// parseRanValue 解析 ran 的值，如 <7d、>=12h，省略比较符号时视为 <
+func parseRanValue(value string) (string, time.Duration, error) {
+	op := "<"
+	for _, candidate := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(value, candidate) {
+			op = candidate
+			value = value[len(candidate):]
+			break
+		}
+	}
+
+	units := map[byte]time.Duration{
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+	if value == "" {
+		return "", 0, fmt.Errorf("missing duration, expected a value like 7d")
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return "", 0, fmt.Errorf("invalid duration %q, expected a number followed by m, h, d or w", value)
+	}
+	// ParseFloat 接受 NaN、Inf 等写法，需要排除；过大的值转换为 Duration 时会溢出
+	n, err := strconv.ParseFloat(value[:len(value)-1], 64)
+	if err != nil || math.IsNaN(n) || n < 0 || n*float64(unit) >= math.MaxInt64 {
+		return "", 0, fmt.Errorf("invalid duration %q, expected a number followed by m, h, d or w", value)
+	}
+	return op, time.Duration(n * float64(unit)), nil
+}
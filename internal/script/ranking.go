@@ -0,0 +1,145 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 支持的排序方式
+const (
+	RankingFrecency     = "frecency"     // 综合运行次数和最近运行时间
+	RankingRecent       = "recent"       // 最近运行的在前
+	RankingAlphabetical = "alphabetical" // 按名称排序
+	RankingManual       = "manual"       // 保持 scripts.json 中的顺序
+)
+
+// frecencyHalfLife 频率分数的半衰期，一周前的一次运行相当于现在的半次
+const frecencyHalfLife = 7 * 24 * time.Hour
+
+// frecencyWeight 频率分数折算成搜索分数的权重
+const frecencyWeight = 8
+
+// parseRanking 解析排序方式，空字符串视为 frecency
+func parseRanking(name string) (string, error) {
+	switch ranking := strings.ToLower(strings.TrimSpace(name)); ranking {
+	case "":
+		return RankingFrecency, nil
+	case RankingFrecency, RankingRecent, RankingAlphabetical, RankingManual:
+		return ranking, nil
+	default:
+		return "", fmt.Errorf("unsupported ranking %q", name)
+	}
+}
+
+// decay 返回经过 elapsed 后分数的衰减系数
+func decay(elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(elapsed) / float64(frecencyHalfLife))
+}
+
+// FrecencyAt 返回脚本在 now 时刻的频率分数。
+// 每次运行加 1 分，分数随时间按半衰期衰减，经常运行的脚本不会被偶尔运行一次的脚本挤下去。
+func (s ScriptState) FrecencyAt(now time.Time) float64 {
+	if s.FrecencyTime.IsZero() {
+		// 旧版本的状态文件没有分数，把全部运行次数视为在最后一次运行时发生
+		if s.RunCount == 0 {
+			return 0
+		}
+		return float64(s.RunCount) * decay(now.Sub(s.LastRunTime))
+	}
+	return s.Frecency * decay(now.Sub(s.FrecencyTime))
+}
+
+// bumpFrecency 记入一次在 at 时刻的运行
+func (s *ScriptState) bumpFrecency(at time.Time) {
+	s.Frecency = s.FrecencyAt(at) + 1
+	s.FrecencyTime = at
+}
+
+// sortScripts 按配置的排序方式排列脚本，scripts 需要保持 scripts.json 中的顺序
+func (m *Manager) sortScripts(scripts []Script) {
+	less := m.rankingLess(time.Now())
+	sort.SliceStable(scripts, func(i, j int) bool {
+		return less(scripts[i], scripts[j])
+	})
+}
+
+// rankingLess 返回排序方式的比较函数，置顶的脚本按置顶顺序排在最前面；
+// 其余脚本按配置的排序方式排列，manual 的比较结果都为 false，保持原有顺序
+func (m *Manager) rankingLess(now time.Time) func(a, b Script) bool {
+	less := m.configuredLess(now)
+	return func(a, b Script) bool {
+		if a.State.Pinned != b.State.Pinned {
+			return a.State.Pinned
+		}
+		if a.State.Pinned && a.State.PinOrder != b.State.PinOrder {
+			return a.State.PinOrder < b.State.PinOrder
+		}
+		return less != nil && less(a, b)
+	}
+}
+
+// configuredLess 返回配置的排序方式对应的比较函数，manual 返回 nil
+func (m *Manager) configuredLess(now time.Time) func(a, b Script) bool {
+	ranking, _ := parseRanking(m.config.Ranking)
+	switch ranking {
+	case RankingManual:
+		return nil
+	case RankingAlphabetical:
+		return lessName
+	case RankingRecent:
+		return lessRecent
+	default:
+		return func(a, b Script) bool {
+			fa, fb := a.State.FrecencyAt(now), b.State.FrecencyAt(now)
+			if fa != fb {
+				return fa > fb
+			}
+			return lessRecent(a, b)
+		}
+	}
+}
+
+// rankingBoost 返回排序方式对搜索分数的加分。
+// frecency 把频率分数取对数后加到匹配分数上，常用脚本能超过匹配稍好的脚本，但不会压过明显更好的匹配；
+// 其他排序方式只在匹配分数相同时起作用。
+func (m *Manager) rankingBoost(now time.Time) func(Script) float64 {
+	ranking, _ := parseRanking(m.config.Ranking)
+	return func(script Script) float64 {
+		if ranking != RankingFrecency {
+			return 0
+		}
+		return frecencyWeight * math.Log2(1+script.State.FrecencyAt(now))
+	}
+}
+
+// lessRecent 最近运行的在前，都没有运行过时按名称排序
+func lessRecent(a, b Script) bool {
+	ta, tb := a.State.LastRunTime, b.State.LastRunTime
+	switch {
+	case ta.IsZero() && tb.IsZero():
+		return lessName(a, b)
+	case ta.IsZero():
+		return false
+	case tb.IsZero():
+		return true
+	case !ta.Equal(tb):
+		return ta.After(tb)
+	default:
+		return lessName(a, b)
+	}
+}
+
+// lessName 按名称排序，名称相同时按 ID 排序
+func lessName(a, b Script) bool {
+	na, nb := strings.ToLower(a.Name), strings.ToLower(b.Name)
+	if na != nb {
+		return na < nb
+	}
+	return a.ID < b.ID
+}
@@ -0,0 +1,77 @@
+package script
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func scriptIDs(scripts []Script) []string {
+	ids := make([]string, len(scripts))
+	for i, script := range scripts {
+		ids[i] = script.ID
+	}
+	return ids
+}
+
+func TestSortScripts(t *testing.T) {
+	now := time.Now()
+	ran := func(ago time.Duration, runs int) ScriptState {
+		s := ScriptState{LastRunTime: now.Add(-ago), RunCount: runs}
+		for i := 0; i < runs; i++ {
+			s.bumpFrecency(now.Add(-ago))
+		}
+		return s
+	}
+	pinned := func(order int) ScriptState {
+		return ScriptState{Pinned: true, PinOrder: order}
+	}
+
+	// 按 scripts.json 中的顺序排列
+	scripts := []Script{
+		{ID: "delta", Name: "delta"},
+		{ID: "often", Name: "often", State: ran(3*24*time.Hour, 20)},
+		{ID: "pin-2", Name: "pin-2", State: pinned(2)},
+		{ID: "alpha", Name: "alpha"},
+		{ID: "recent", Name: "recent", State: ran(time.Hour, 1)},
+		{ID: "pin-1", Name: "pin-1", State: pinned(1)},
+	}
+
+	tests := []struct {
+		ranking string
+		want    []string
+	}{
+		{RankingFrecency, []string{"pin-1", "pin-2", "often", "recent", "alpha", "delta"}},
+		{RankingRecent, []string{"pin-1", "pin-2", "recent", "often", "alpha", "delta"}},
+		{RankingAlphabetical, []string{"pin-1", "pin-2", "alpha", "delta", "often", "recent"}},
+		{RankingManual, []string{"pin-1", "pin-2", "delta", "often", "alpha", "recent"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ranking, func(t *testing.T) {
+			m := newTestManager(t)
+			m.config.Ranking = tt.ranking
+			sorted := append([]Script(nil), scripts...)
+			m.sortScripts(sorted)
+			if got := scriptIDs(sorted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrecencyDecay(t *testing.T) {
+	now := time.Now()
+	var s ScriptState
+	s.bumpFrecency(now.Add(-2 * frecencyHalfLife))
+	s.bumpFrecency(now.Add(-frecencyHalfLife))
+	// 两个半衰期前的一次衰减为 0.25，一个半衰期前的两次（含前一次衰减后的分数）衰减为 0.5
+	if got, want := s.FrecencyAt(now), 0.75; got < want-1e-9 || got > want+1e-9 {
+		t.Errorf("FrecencyAt = %v, want %v", got, want)
+	}
+
+	// 旧版本的状态只有运行次数
+	legacy := ScriptState{RunCount: 4, LastRunTime: now.Add(-frecencyHalfLife)}
+	if got := legacy.FrecencyAt(now); got < 2-1e-9 || got > 2+1e-9 {
+		t.Errorf("legacy FrecencyAt = %v, want 2", got)
+	}
+}
@@ -0,0 +1,209 @@
+package script
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// 输出停顿超过该时间时，把尚未换行的内容作为不完整行发出
+const partialFlushDelay = 100 * time.Millisecond
+
+// 每次从输出管道读取的最大字节数
+const outputChunkSize = 32 * 1024
+
+// OutputKind 输出事件的类型。
+// 三种类型的 Data 都是当前行的完整内容，界面收到后用它替换正在显示的当前行；
+// 只有 OutputLine 表示该行已经结束，之后的输出属于新的一行。
+type OutputKind int
+
+const (
+	OutputLine    OutputKind = iota // 以换行结束的完整行
+	OutputPartial                   // 输出停顿时发出的不完整行，后续输出可能继续这一行
+	OutputReplace                   // 回车（\r）更新，例如进度条，替换当前行
+)
+
+func (k OutputKind) String() string {
+	switch k {
+	case OutputLine:
+		return "line"
+	case OutputPartial:
+		return "partial"
+	case OutputReplace:
+		return "replace"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText 以名称形式序列化输出类型
+func (k OutputKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// lineSplitter 把原始输出切分成行，处理回车和不完整行
+type lineSplitter struct {
+	emit func(kind OutputKind, data []byte) bool
+
+	line      []byte // 当前行自上次换行或回车以来的内容
+	emitted   bool   // 当前内容是否已经作为不完整行发出
+	carriage  bool   // 当前行是否被回车改写过
+	pendingCR bool   // 上一块数据以 \r 结尾，需要看下一个字节是否是 \n
+}
+
+// write 处理一块输出，emit 返回 false 时停止
+func (s *lineSplitter) write(data []byte) bool {
+	for len(data) > 0 {
+		if s.pendingCR {
+			s.pendingCR = false
+			if data[0] == '\n' {
+				data = data[1:]
+				if !s.endLine() {
+					return false
+				}
+				continue
+			}
+			if !s.carriageReturn() {
+				return false
+			}
+		}
+
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			s.appendLine(data)
+			return true
+		}
+		s.appendLine(data[:i])
+
+		if data[i] == '\n' {
+			data = data[i+1:]
+			if !s.endLine() {
+				return false
+			}
+			continue
+		}
+
+		// \r\n 视为普通换行，单独的 \r 视为回到行首
+		data = data[i+1:]
+		if len(data) == 0 {
+			s.pendingCR = true
+			return true
+		}
+		if data[0] == '\n' {
+			data = data[1:]
+			if !s.endLine() {
+				return false
+			}
+			continue
+		}
+		if !s.carriageReturn() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *lineSplitter) appendLine(data []byte) {
+	if len(data) > 0 {
+		s.line = append(s.line, data...)
+		s.emitted = false
+	}
+}
+
+// endLine 发出完整的一行并开始新行
+func (s *lineSplitter) endLine() bool {
+	ok := s.emit(OutputLine, s.line)
+	s.line = s.line[:0]
+	s.emitted = false
+	s.carriage = false
+	return ok
+}
+
+// carriageReturn 发出回车前的内容，之后的输出将替换当前行
+func (s *lineSplitter) carriageReturn() bool {
+	ok := true
+	if len(s.line) > 0 && !s.emitted {
+		ok = s.emit(OutputReplace, s.line)
+	}
+	s.line = s.line[:0]
+	s.emitted = false
+	s.carriage = true
+	return ok
+}
+
+// flushPartial 输出停顿时发出尚未换行的内容
+func (s *lineSplitter) flushPartial() bool {
+	if s.pendingCR {
+		s.pendingCR = false
+		if !s.carriageReturn() {
+			return false
+		}
+	}
+	if len(s.line) == 0 || s.emitted {
+		return true
+	}
+	s.emitted = true
+	if s.carriage {
+		return s.emit(OutputReplace, s.line)
+	}
+	return s.emit(OutputPartial, s.line)
+}
+
+// close 在输出结束时发出剩余内容
+func (s *lineSplitter) close() {
+	if s.pendingCR {
+		s.pendingCR = false
+		s.carriageReturn()
+	}
+	if len(s.line) > 0 {
+		s.endLine()
+	}
+}
+
+// readOutput 持续读取输出直到 EOF，不限制行长度。
+// emit 收到的 data 只在回调期间有效；emit 返回 false 时停止读取。
+func readOutput(r io.Reader, emit func(kind OutputKind, data []byte) bool) {
+	chunks := make(chan []byte)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		defer close(chunks)
+		for {
+			buf := make([]byte, outputChunkSize)
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- buf[:n]:
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	splitter := &lineSplitter{emit: emit}
+	timer := time.NewTimer(partialFlushDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				splitter.close()
+				return
+			}
+			if !splitter.write(chunk) {
+				return
+			}
+			timer.Reset(partialFlushDelay)
+		case <-timer.C:
+			if !splitter.flushPartial() {
+				return
+			}
+		}
+	}
+}
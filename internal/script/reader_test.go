@@ -0,0 +1,166 @@
+package script
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// flushStep 在测试步骤中表示一次输出停顿
+const flushStep = "<flush>"
+
+type outputRecord struct {
+	Kind OutputKind
+	Data string
+}
+
+func TestLineSplitter(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string
+		want  []outputRecord
+	}{
+		{
+			name:  "lines",
+			steps: []string{"a\nb\n"},
+			want:  []outputRecord{{OutputLine, "a"}, {OutputLine, "b"}},
+		},
+		{
+			name:  "empty lines",
+			steps: []string{"\n\n"},
+			want:  []outputRecord{{OutputLine, ""}, {OutputLine, ""}},
+		},
+		{
+			name:  "last line without newline",
+			steps: []string{"a\nb"},
+			want:  []outputRecord{{OutputLine, "a"}, {OutputLine, "b"}},
+		},
+		{
+			name:  "line split across reads",
+			steps: []string{"ab", "c\n"},
+			want:  []outputRecord{{OutputLine, "abc"}},
+		},
+		{
+			name:  "crlf",
+			steps: []string{"a\r\nb\r\n"},
+			want:  []outputRecord{{OutputLine, "a"}, {OutputLine, "b"}},
+		},
+		{
+			name:  "crlf split across reads",
+			steps: []string{"a\r", "\nb\r", "\n"},
+			want:  []outputRecord{{OutputLine, "a"}, {OutputLine, "b"}},
+		},
+		{
+			name:  "carriage return",
+			steps: []string{"10%\r50%\r100%\n"},
+			want:  []outputRecord{{OutputReplace, "10%"}, {OutputReplace, "50%"}, {OutputLine, "100%"}},
+		},
+		{
+			name:  "carriage return at end of read",
+			steps: []string{"10%\r", "50%\n"},
+			want:  []outputRecord{{OutputReplace, "10%"}, {OutputLine, "50%"}},
+		},
+		{
+			name:  "carriage return at end of output",
+			steps: []string{"10%\r"},
+			want:  []outputRecord{{OutputReplace, "10%"}},
+		},
+		{
+			name:  "partial flush",
+			steps: []string{"abc", flushStep, "def\n"},
+			want:  []outputRecord{{OutputPartial, "abc"}, {OutputLine, "abcdef"}},
+		},
+		{
+			name:  "partial flush only once",
+			steps: []string{"abc", flushStep, flushStep},
+			want:  []outputRecord{{OutputPartial, "abc"}, {OutputLine, "abc"}},
+		},
+		{
+			name:  "partial flush with nothing pending",
+			steps: []string{"a\n", flushStep},
+			want:  []outputRecord{{OutputLine, "a"}},
+		},
+		{
+			name:  "partial flush after carriage return",
+			steps: []string{"10%\r50%", flushStep, "\r100%\n"},
+			want:  []outputRecord{{OutputReplace, "10%"}, {OutputReplace, "50%"}, {OutputLine, "100%"}},
+		},
+		{
+			name:  "partial flush with pending carriage return",
+			steps: []string{"10%\r", flushStep, "50%", flushStep},
+			want:  []outputRecord{{OutputReplace, "10%"}, {OutputReplace, "50%"}, {OutputLine, "50%"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []outputRecord
+			s := &lineSplitter{emit: func(kind OutputKind, data []byte) bool {
+				got = append(got, outputRecord{kind, string(data)})
+				return true
+			}}
+			for _, step := range tt.steps {
+				if step == flushStep {
+					s.flushPartial()
+				} else {
+					s.write([]byte(step))
+				}
+			}
+			s.close()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineSplitterStop(t *testing.T) {
+	var got []outputRecord
+	s := &lineSplitter{emit: func(kind OutputKind, data []byte) bool {
+		got = append(got, outputRecord{kind, string(data)})
+		return false
+	}}
+	if s.write([]byte("a\nb\n")) {
+		t.Error("write returned true after emit returned false")
+	}
+	if want := []outputRecord{{OutputLine, "a"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadOutputFlushesPartialLine(t *testing.T) {
+	r, w := io.Pipe()
+	records := make(chan outputRecord, 4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readOutput(r, func(kind OutputKind, data []byte) bool {
+			records <- outputRecord{kind, string(data)}
+			return true
+		})
+	}()
+
+	w.Write([]byte("Password: "))
+	select {
+	case got := <-records:
+		if want := (outputRecord{OutputPartial, "Password: "}); got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	case <-time.After(10 * partialFlushDelay):
+		t.Fatal("partial line was not flushed")
+	}
+
+	w.Write([]byte("ok\n"))
+	w.Close()
+	<-done
+	close(records)
+
+	var rest []outputRecord
+	for record := range records {
+		rest = append(rest, record)
+	}
+	if want := []outputRecord{{OutputLine, "Password: ok"}}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("got %v, want %v", rest, want)
+	}
+}
@@ -0,0 +1,160 @@
+package script
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 每次运行保留的最近输出条数
+const maxRunOutputLines = 200
+
+// 注册表中保留的已结束运行数量，超出后丢弃最早结束的记录
+const maxFinishedRuns = 50
+
+// ErrRunNotFound 表示注册表中不存在指定 ID 的运行
+var ErrRunNotFound = errors.New("run not found")
+
+// RunState 运行状态
+type RunState string
+
+const (
+	RunQueued    RunState = "queued"
+	RunRunning   RunState = "running"
+	RunSucceeded RunState = "succeeded"
+	RunFailed    RunState = "failed"
+	RunCancelled RunState = "cancelled"
+)
+
+// Finished 返回运行是否已经结束
+func (s RunState) Finished() bool {
+	return s == RunSucceeded || s == RunFailed || s == RunCancelled
+}
+
+// RunInfo 是某次运行在某一时刻的快照
+type RunInfo struct {
+	ID         string        `json:"id"`
+	ScriptID   string        `json:"script_id"`
+	ScriptName string        `json:"script_name"`
+	State      RunState      `json:"state"`
+	StartTime  time.Time     `json:"start_time"`
+	EndTime    time.Time     `json:"end_time,omitempty"`
+	PID        int           `json:"pid,omitempty"`
+	Trigger    string        `json:"trigger"`
+	Output     []OutputEvent `json:"output"`
+
+	// Result 运行结束后才有值
+	Result *RunResult `json:"result,omitempty"`
+}
+
+// registry 记录当前进程内的所有脚本运行
+type registry struct {
+	mu   sync.RWMutex
+	runs map[string]*Run
+}
+
+func newRegistry() *registry {
+	return &registry{
+		runs: make(map[string]*Run),
+	}
+}
+
+// add 注册一次运行，并清理过多的已结束运行
+func (r *registry) add(run *Run) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.runs[run.id] = run
+	r.prune()
+}
+
+func (r *registry) get(id string) (*Run, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	run, ok := r.runs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, id)
+	}
+	return run, nil
+}
+
+// list 返回所有运行的快照，按开始时间排序
+func (r *registry) list() []RunInfo {
+	r.mu.RLock()
+	infos := make([]RunInfo, 0, len(r.runs))
+	for _, run := range r.runs {
+		infos = append(infos, run.Info())
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartTime.Before(infos[j].StartTime)
+	})
+	return infos
+}
+
+// prune 丢弃最早结束的运行，调用方需持有写锁
+func (r *registry) prune() {
+	var finished []RunInfo
+	for _, run := range r.runs {
+		if info := run.Info(); info.State.Finished() {
+			finished = append(finished, info)
+		}
+	}
+	if len(finished) <= maxFinishedRuns {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].EndTime.Before(finished[j].EndTime)
+	})
+	for _, info := range finished[:len(finished)-maxFinishedRuns] {
+		delete(r.runs, info.ID)
+	}
+}
+
+// newRunID 生成以时间开头、便于排序的运行 ID
+func newRunID() string {
+	var b [4]byte
+	rand.Read(b[:])
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b[:])
+}
+
+// ListRuns 返回当前进程内所有运行的快照
+func (m *Manager) ListRuns() []RunInfo {
+	return m.runs.list()
+}
+
+// GetRun 返回指定运行的快照
+func (m *Manager) GetRun(id string) (RunInfo, error) {
+	run, err := m.runs.get(id)
+	if err != nil {
+		return RunInfo{}, err
+	}
+	return run.Info(), nil
+}
+
+// StopRun 请求停止指定运行，不等待其结束
+func (m *Manager) StopRun(id string) error {
+	run, err := m.runs.get(id)
+	if err != nil {
+		return err
+	}
+	run.Stop()
+	return nil
+}
+
+// WaitRun 等待指定运行结束并返回最终快照
+func (m *Manager) WaitRun(id string) (RunInfo, error) {
+	run, err := m.runs.get(id)
+	if err != nil {
+		return RunInfo{}, err
+	}
+	run.Wait()
+	return run.Info(), nil
+}
@@ -0,0 +1,81 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrRunCancelled 表示运行因取消或停止请求而结束
+var ErrRunCancelled = errors.New("script run cancelled")
+
+// ExitError 表示脚本以非零退出码或信号结束
+type ExitError struct {
+	ScriptName string
+	ExitCode   int
+	Signal     string
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("script %q terminated by signal %s", e.ScriptName, e.Signal)
+	}
+	return fmt.Sprintf("script %q exited with code %d", e.ScriptName, e.ExitCode)
+}
+
+// RunResult 一次运行的结构化结果
+type RunResult struct {
+	RunID       string        `json:"run_id"`
+	ScriptID    string        `json:"script_id"`
+	ScriptName  string        `json:"script_name"`
+	ExitCode    int           `json:"exit_code"`
+	Signal      string        `json:"signal,omitempty"`
+	StartTime   time.Time     `json:"start_time"`
+	EndTime     time.Time     `json:"end_time"`
+	Duration    time.Duration `json:"duration"`
+	StdoutBytes int64         `json:"stdout_bytes"`
+	StderrBytes int64         `json:"stderr_bytes"`
+
+	// Err 为 nil 表示成功，否则为 ErrRunCancelled 或 *ExitError 等错误
+	Err error `json:"-"`
+}
+
+// Success 返回脚本是否成功结束
+func (r *RunResult) Success() bool {
+	return r.Err == nil
+}
+
+// newRunResult 根据进程状态生成运行结果
+func newRunResult(run *Run, state *os.ProcessState, waitErr error) *RunResult {
+	result := &RunResult{
+		RunID:       run.id,
+		ScriptID:    run.script.ID,
+		ScriptName:  run.script.Name,
+		ExitCode:    -1,
+		StartTime:   run.startTime,
+		EndTime:     time.Now(),
+		StdoutBytes: run.stdoutBytes.Load(),
+		StderrBytes: run.stderrBytes.Load(),
+	}
+	result.Duration = result.EndTime.Sub(result.StartTime)
+
+	if state != nil {
+		result.ExitCode = state.ExitCode()
+		result.Signal = exitSignal(state)
+	}
+
+	switch {
+	case run.Stopped():
+		result.Err = ErrRunCancelled
+	case state != nil && !state.Success():
+		result.Err = &ExitError{
+			ScriptName: run.script.Name,
+			ExitCode:   result.ExitCode,
+			Signal:     result.Signal,
+		}
+	case waitErr != nil:
+		result.Err = waitErr
+	}
+	return result
+}
@@ -0,0 +1,347 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+// 脚本进程退出后，等待输出读取完成的最长时间。
+// 脚本派生的后台进程可能继续持有输出管道，超时后不再等待。
+const outputDrainTimeout = 2 * time.Second
+
+// errInterruptUnsupported 无法向脚本发送中断，停止时直接结束进程组
+var errInterruptUnsupported = errors.New("interrupt not supported")
+
+// RunOption 定义单次运行的配置选项
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	gracePeriod time.Duration
+	params      map[string]string
+	trigger     string
+}
+
+// WithGracePeriod 设置停止脚本时从发送中断到强制结束的等待时间
+func WithGracePeriod(d time.Duration) RunOption {
+	return func(o *runOptions) {
+		o.gracePeriod = d
+	}
+}
+
+// WithParams 设置本次运行的参数值，参数按脚本声明校验后传给脚本
+func WithParams(values map[string]string) RunOption {
+	return func(o *runOptions) {
+		o.params = values
+	}
+}
+
+// WithTrigger 设置运行的触发来源，例如 TriggerGUI，记录在运行历史中
+func WithTrigger(source string) RunOption {
+	return func(o *runOptions) {
+		o.trigger = source
+	}
+}
+
+// Run 表示一次正在执行或已经结束的脚本运行
+type Run struct {
+	id          string
+	script      Script
+	trigger     string
+	cmd         *exec.Cmd
+	group       *processGroup
+	logger      *logger.Logger
+	gracePeriod time.Duration
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	stopped  atomic.Bool
+
+	exited  chan struct{} // 脚本进程已退出
+	drained chan struct{} // 输出管道已全部关闭
+	done    chan struct{} // 输出处理和收尾工作已完成
+	result  *RunResult
+
+	stdoutBytes atomic.Int64
+	stderrBytes atomic.Int64
+	seq         atomic.Uint64
+
+	mu         sync.Mutex
+	state      RunState
+	startTime  time.Time
+	endTime    time.Time
+	pid        int
+	params     map[string]string // 已脱敏的参数
+	output     []OutputEvent
+	outputFile io.WriteCloser // 完整输出，保存在运行历史中
+}
+
+// countingReader 统计从输出管道读取的字节数
+type countingReader struct {
+	r     io.Reader
+	count *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.count.Add(int64(n))
+	return n, err
+}
+
+func newRun(script Script, log *logger.Logger, options runOptions) *Run {
+	return &Run{
+		id:          newRunID(),
+		script:      script,
+		trigger:     options.trigger,
+		logger:      log,
+		gracePeriod: options.gracePeriod,
+		stopCh:      make(chan struct{}),
+		exited:      make(chan struct{}),
+		drained:     make(chan struct{}),
+		done:        make(chan struct{}),
+		state:       RunQueued,
+		startTime:   time.Now(),
+	}
+}
+
+// ID 返回运行 ID
+func (r *Run) ID() string {
+	return r.id
+}
+
+// Script 返回本次运行的脚本
+func (r *Run) Script() Script {
+	return r.script
+}
+
+// PID 返回脚本进程 ID，尚未启动时返回 0
+func (r *Run) PID() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pid
+}
+
+// Info 返回运行的当前快照
+func (r *Run) Info() RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	output := make([]OutputEvent, len(r.output))
+	copy(output, r.output)
+	return RunInfo{
+		ID:         r.id,
+		ScriptID:   r.script.ID,
+		ScriptName: r.script.Name,
+		State:      r.state,
+		StartTime:  r.startTime,
+		EndTime:    r.endTime,
+		PID:        r.pid,
+		Trigger:    r.trigger,
+		Output:     output,
+		Result:     r.result,
+	}
+}
+
+// started 记录脚本进程已经启动
+func (r *Run) started(cmd *exec.Cmd, group *processGroup) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cmd = cmd
+	r.group = group
+	r.pid = cmd.Process.Pid
+	r.state = RunRunning
+	r.startTime = time.Now()
+}
+
+// finish 记录运行结果，并据此设置最终状态
+func (r *Run) finish(result *RunResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case result.Err == nil:
+		r.state = RunSucceeded
+	case errors.Is(result.Err, ErrRunCancelled):
+		r.state = RunCancelled
+	default:
+		r.state = RunFailed
+	}
+	r.result = result
+	r.endTime = result.EndTime
+
+	if r.outputFile != nil {
+		r.outputFile.Close()
+		r.outputFile = nil
+	}
+}
+
+// historyRecord 根据运行结果生成历史记录，需要在运行结束后调用
+func (r *Run) historyRecord(outputPath string) HistoryRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record := HistoryRecord{
+		RunID:      r.id,
+		ScriptID:   r.script.ID,
+		ScriptName: r.script.Name,
+		ScriptPath: r.script.Path,
+		Params:     r.params,
+		Trigger:    r.trigger,
+		State:      r.state,
+		ExitCode:   r.result.ExitCode,
+		Signal:     r.result.Signal,
+		StartTime:  r.result.StartTime,
+		EndTime:    r.result.EndTime,
+		Duration:   r.result.Duration,
+		OutputFile: outputPath,
+	}
+	if r.result.Err != nil {
+		record.Error = r.result.Err.Error()
+	}
+	return record
+}
+
+// appendOutput 保存一条输出，只保留最近的若干条
+func (r *Run) appendOutput(event OutputEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 同一输出流的不完整行和进度更新只保留最新的一条
+	for i := len(r.output) - 1; i >= 0; i-- {
+		if r.output[i].Stream != event.Stream {
+			continue
+		}
+		if r.output[i].Kind != OutputLine {
+			r.output = append(r.output[:i], r.output[i+1:]...)
+		}
+		break
+	}
+
+	r.output = append(r.output, event)
+
+	if r.outputFile != nil && event.Kind == OutputLine {
+		fmt.Fprintf(r.outputFile, "%s [%s] %s\n", event.Time.Format("15:04:05.000"), event.Stream, event.Data)
+	}
+	if len(r.output) > maxRunOutputLines {
+		r.output = append(r.output[:0], r.output[len(r.output)-maxRunOutputLines:]...)
+	}
+}
+
+// Stop 请求停止脚本，先发送中断，超过等待时间后强制结束整个进程组。
+// Stop 不会阻塞，需要等待结束时调用 Wait。
+func (r *Run) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+}
+
+// Stopped 返回脚本是否因取消或停止请求而结束
+func (r *Run) Stopped() bool {
+	return r.stopped.Load()
+}
+
+// Done 返回在运行结束时关闭的通道
+func (r *Run) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait 等待运行结束并返回运行结果，运行失败时错误与 RunResult.Err 相同
+func (r *Run) Wait() (*RunResult, error) {
+	<-r.done
+	return r.result, r.result.Err
+}
+
+// supervise 监听取消信号，收到后终止脚本进程组
+func (r *Run) supervise(done <-chan struct{}) {
+	select {
+	case <-r.exited:
+		return
+	case <-done:
+	case <-r.stopCh:
+	}
+	r.terminate()
+}
+
+// terminate 先中断进程组，等待进程退出和输出关闭，超时后强制结束
+func (r *Run) terminate() {
+	r.stopped.Store(true)
+	r.logger.WithFields(logger.Fields{
+		"runID":       r.id,
+		"scriptName":  r.script.Name,
+		"pid":         r.PID(),
+		"gracePeriod": r.gracePeriod,
+	}).Info("Stopping script")
+
+	if err := r.group.interrupt(); errors.Is(err, errInterruptUnsupported) {
+		r.logger.WithField("scriptName", r.script.Name).Debug("Interrupt not supported, killing process group")
+	} else if err != nil {
+		r.logger.WithError(err).Warn("Failed to interrupt script, killing it")
+	} else {
+		timer := time.NewTimer(r.gracePeriod)
+		defer timer.Stop()
+
+		select {
+		case <-r.drained:
+		case <-timer.C:
+			r.logger.WithField("scriptName", r.script.Name).Warn("Script did not exit in time, killing process group")
+		}
+	}
+
+	// 脚本已经退出时，继续清理残留的子进程
+	if err := r.group.kill(); err != nil {
+		r.logger.WithError(err).Debug("Kill process group returned error")
+	}
+}
+
+// nextSeq 返回下一条输出事件的序号
+func (r *Run) nextSeq() uint64 {
+	return r.seq.Add(1)
+}
+
+// systemEvent 创建一条 x-script 自身的状态信息
+func (r *Run) systemEvent(message string) OutputEvent {
+	now := time.Now()
+	return OutputEvent{
+		RunID:  r.id,
+		Stream: StreamSystem,
+		Time:   now,
+		Offset: now.Sub(r.startTime),
+		Data:   []byte(message),
+	}
+}
+
+// emitSystem 在脚本进程启动前发出状态信息
+func (r *Run) emitSystem(message string, handler OutputHandler) {
+	event := r.systemEvent(message)
+	event.Seq = r.nextSeq()
+	r.appendOutput(event)
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// abort 在脚本进程启动前结束运行
+func (r *Run) abort(err error) error {
+	event := r.systemEvent(err.Error())
+	event.Seq = r.nextSeq()
+	r.appendOutput(event)
+	r.finish(&RunResult{
+		RunID:      r.id,
+		ScriptID:   r.script.ID,
+		ScriptName: r.script.Name,
+		ExitCode:   -1,
+		StartTime:  r.startTime,
+		EndTime:    event.Time,
+		Duration:   event.Time.Sub(r.startTime),
+		Err:        err,
+	})
+	close(r.done)
+	return err
+}
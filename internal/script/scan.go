@@ -0,0 +1,278 @@
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 读取元数据头时最多读取的字节数和行数
+const (
+	headerMaxBytes = 8 * 1024
+	headerMaxLines = 64
+)
+
+// headerPattern 匹配元数据行，如 "x-script: name=构建工具, category=dev/build, tags=build, tools"
+var headerPattern = regexp.MustCompile(`^(?i:x-script)\s*:\s*(.*)$`)
+
+// headerKeyPattern 匹配元数据中 "key=value" 的开头
+var headerKeyPattern = regexp.MustCompile(`^\s*([a-z_]+)\s*=(.*)$`)
+
+// 注释前缀，覆盖 Python/Shell/PowerShell、JavaScript/Go 和批处理
+var headerCommentPrefixes = []string{"#", "//", "--", "::", "REM ", "rem "}
+
+// skipDirs 扫描时跳过的目录
+var skipDirs = map[string]bool{
+	"__pycache__":  true,
+	"node_modules": true,
+}
+
+// scriptHeader 脚本文件开头的元数据
+type scriptHeader struct {
+	Fields    map[string]string
+	Ignore    bool   // 标记了 x-script: ignore
+	Docstring string // Python 模块文档字符串的第一行
+	Unknown   []string
+}
+
+// discoverScripts 扫描 ScriptsDir，为未在 scripts.json 中登记的脚本生成条目。
+// 只登记有解释器的脚本，可执行文件和批处理不会自动登记。
+func (m *Manager) discoverScripts(explicit []catalogEntry) ([]catalogEntry, []Diagnostic) {
+	// scripts.json 中已登记的路径和 ID 优先；自动发现的脚本生成的 ID 冲突时由 assignIDs 区分
+	paths := make(map[string]bool, len(explicit))
+	scripts := make([]Script, len(explicit))
+	for i, entry := range explicit {
+		paths[filepath.ToSlash(filepath.Clean(entry.Path))] = true
+		scripts[i] = entry.Script
+	}
+	ids := make(map[string]bool, len(explicit))
+	for _, id := range assignIDs(scripts) {
+		ids[id] = true
+	}
+
+	extensions := make(map[string]bool)
+	for _, profile := range m.interpreterProfiles() {
+		if profile.Command == "" {
+			continue
+		}
+		for _, ext := range profile.Extensions {
+			extensions[strings.ToLower(ext)] = true
+		}
+	}
+
+	var entries []catalogEntry
+	var diags []Diagnostic
+	root := m.config.ScriptsDir
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			diags = append(diags, Diagnostic{Severity: SeverityWarning, Index: -1, File: path, Message: err.Error()})
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && skipScanDir(path, d.Name()) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !extensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if paths[rel] {
+			return nil
+		}
+
+		header, err := readScriptHeader(path)
+		if err != nil {
+			diags = append(diags, Diagnostic{Severity: SeverityWarning, Index: -1, File: rel, Message: err.Error()})
+			return nil
+		}
+		if header.Ignore {
+			return nil
+		}
+		for _, key := range header.Unknown {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Index:    -1,
+				File:     rel,
+				Field:    key,
+				Message:  "unknown header field",
+			})
+		}
+
+		entry := catalogEntry{index: -1, file: rel}
+		entry.Path = rel
+		entry.Discovered = true
+		header.apply(&entry.Script)
+		if id := entry.ID; id != "" && ids[id] {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Index:    -1,
+				File:     rel,
+				ScriptID: id,
+				Field:    "id",
+				Message:  "id already used in scripts.json, file skipped",
+			})
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		diags = append(diags, Diagnostic{Severity: SeverityWarning, Index: -1, File: root, Message: err.Error()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].file < entries[j].file
+	})
+	return entries, diags
+}
+
+// skipScanDir 判断是否跳过目录：隐藏目录、缓存目录和虚拟环境
+func skipScanDir(path, name string) bool {
+	if strings.HasPrefix(name, ".") || skipDirs[name] {
+		return true
+	}
+	if _, err := os.Stat(filepath.Join(path, "pyvenv.cfg")); err == nil {
+		return true
+	}
+	return false
+}
+
+// apply 把元数据写入脚本，未声明名称时使用文件名，未声明描述时使用文档字符串
+func (h scriptHeader) apply(script *Script) {
+	script.ID = h.Fields["id"]
+	script.Name = h.Fields["name"]
+	script.Description = h.Fields["description"]
+	script.Tags = splitTags(h.Fields["tags"] + "," + h.Fields["keywords"])
+	script.Category = h.Fields["category"]
+	script.Interpreter = h.Fields["interpreter"]
+	script.OutputEncoding = h.Fields["output_encoding"]
+	script.Cwd = h.Fields["cwd"]
+
+	if script.Name == "" {
+		base := filepath.Base(script.Path)
+		script.Name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if script.Description == "" {
+		script.Description = h.Docstring
+	}
+}
+
+// headerFields 元数据支持的字段
+var headerFields = map[string]bool{
+	"id":              true,
+	"name":            true,
+	"description":     true,
+	"tags":            true,
+	"keywords":        true, // 旧版本的写法，与 tags 相同
+	"category":        true,
+	"interpreter":     true,
+	"output_encoding": true,
+	"cwd":             true,
+}
+
+// readScriptHeader 读取脚本开头的注释和文档字符串中的元数据，遇到第一行代码时停止
+func readScriptHeader(path string) (scriptHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return scriptHeader{}, fmt.Errorf("read script header failed: %w", err)
+	}
+	defer file.Close()
+
+	header := scriptHeader{Fields: make(map[string]string)}
+	scanner := bufio.NewScanner(io.LimitReader(file, headerMaxBytes))
+	docQuote := "" // 正在读取的文档字符串的引号，为空表示不在文档字符串中
+	docDone := false
+	for n := 0; n < headerMaxLines && scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if n == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+
+		var text string
+		fromDoc := false
+		switch {
+		case docQuote != "":
+			text = line
+			fromDoc = true
+			if i := strings.Index(line, docQuote); i >= 0 {
+				text = line[:i]
+				docQuote = ""
+				docDone = true
+			}
+		case line == "" || strings.HasPrefix(line, "#!"):
+			continue
+		case !docDone && (strings.HasPrefix(line, `"""`) || strings.HasPrefix(line, "'''")):
+			quote := line[:3]
+			text = line[3:]
+			fromDoc = true
+			if i := strings.Index(text, quote); i >= 0 {
+				text = text[:i]
+				docDone = true
+			} else {
+				docQuote = quote
+			}
+		default:
+			comment, ok := trimCommentPrefix(line)
+			if !ok {
+				return header, nil
+			}
+			text = comment
+		}
+
+		text = strings.TrimSpace(text)
+		if match := headerPattern.FindStringSubmatch(text); match != nil {
+			header.parse(match[1])
+		} else if fromDoc && header.Docstring == "" && text != "" {
+			header.Docstring = text
+		}
+	}
+	return header, nil
+}
+
+// trimCommentPrefix 去掉行首的注释符号
+func trimCommentPrefix(line string) (string, bool) {
+	for _, prefix := range headerCommentPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimPrefix(line, prefix), true
+		}
+	}
+	return "", false
+}
+
+// parse 解析一行元数据。值中可以包含逗号，不以 "key=" 开头的部分属于前一个字段。
+func (h *scriptHeader) parse(value string) {
+	key := ""
+	for _, part := range strings.Split(value, ",") {
+		if match := headerKeyPattern.FindStringSubmatch(part); match != nil {
+			key = match[1]
+			if !headerFields[key] {
+				h.Unknown = append(h.Unknown, key)
+			}
+			h.Fields[key] = strings.TrimSpace(match[2])
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(part), "ignore") && key == "" {
+			h.Ignore = true
+			continue
+		}
+		if key != "" {
+			h.Fields[key] = strings.TrimSpace(h.Fields[key] + "," + part)
+		}
+	}
+}
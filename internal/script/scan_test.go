@@ -0,0 +1,146 @@
+package script
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadScriptHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		fields    map[string]string
+		docstring string
+		ignore    bool
+		unknown   []string
+	}{
+		{
+			name:    "python comment",
+			content: "#!/usr/bin/env python3\n# x-script: name=构建工具, category=dev/build\nimport os\n",
+			fields:  map[string]string{"name": "构建工具", "category": "dev/build"},
+		},
+		{
+			name:    "value containing commas",
+			content: "# x-script: tags=build, tools, release, description=a, b\n",
+			fields:  map[string]string{"tags": "build, tools, release", "description": "a, b"},
+		},
+		{
+			name:    "several header lines",
+			content: "# X-Script: name=sync\n#\n# some notes\n# x-script: tags=backup\nsync()\n",
+			fields:  map[string]string{"name": "sync", "tags": "backup"},
+		},
+		{
+			name:    "stops at first code line",
+			content: "# x-script: name=a\nimport os\n# x-script: tags=late\n",
+			fields:  map[string]string{"name": "a"},
+		},
+		{
+			name:    "byte order mark",
+			content: "\ufeff# x-script: name=bom\n",
+			fields:  map[string]string{"name": "bom"},
+		},
+		{
+			name:    "other comment styles",
+			content: "// x-script: name=js\n-- x-script: category=sql\n:: x-script: tags=bat\nREM x-script: id=rem\n",
+			fields:  map[string]string{"name": "js", "category": "sql", "tags": "bat", "id": "rem"},
+		},
+		{
+			name:      "single line docstring",
+			content:   "\"\"\"Back up the database.\"\"\"\nimport os\n",
+			fields:    map[string]string{},
+			docstring: "Back up the database.",
+		},
+		{
+			name:      "multi line docstring with header",
+			content:   "'''\n  备份数据库\n\n  x-script: tags=db, category=ops\n'''\nimport os\n",
+			fields:    map[string]string{"tags": "db", "category": "ops"},
+			docstring: "备份数据库",
+		},
+		{
+			name:      "only first docstring",
+			content:   "\"\"\"First.\"\"\"\n\"\"\"Second. x-script: name=b\"\"\"\n",
+			fields:    map[string]string{},
+			docstring: "First.",
+		},
+		{
+			name:    "ignore",
+			content: "# x-script: ignore\n",
+			fields:  map[string]string{},
+			ignore:  true,
+		},
+		{
+			name:    "unknown fields",
+			content: "# x-script: name=a, color=red\n",
+			fields:  map[string]string{"name": "a", "color": "red"},
+			unknown: []string{"color"},
+		},
+		{
+			name:    "no header",
+			content: "print('hi')\n# x-script: name=a\n",
+			fields:  map[string]string{},
+		},
+	}
+
+	m := newTestManager(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeScriptFile(t, m, "script.py", tt.content)
+			header, err := readScriptHeader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(header.Fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", header.Fields, tt.fields)
+			}
+			if header.Docstring != tt.docstring {
+				t.Errorf("docstring = %q, want %q", header.Docstring, tt.docstring)
+			}
+			if header.Ignore != tt.ignore {
+				t.Errorf("ignore = %v, want %v", header.Ignore, tt.ignore)
+			}
+			if !reflect.DeepEqual(header.Unknown, tt.unknown) {
+				t.Errorf("unknown = %v, want %v", header.Unknown, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestReadScriptHeaderLimits(t *testing.T) {
+	m := newTestManager(t)
+	// 超过行数限制后的元数据不读取
+	path := writeScriptFile(t, m, "long.py", strings.Repeat("#\n", headerMaxLines)+"# x-script: name=late\n")
+	header, err := readScriptHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Fields) != 0 {
+		t.Errorf("fields = %v, want none after %d lines", header.Fields, headerMaxLines)
+	}
+
+	if _, err := readScriptHeader(path + ".missing"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestScriptHeaderApply(t *testing.T) {
+	header := scriptHeader{
+		Fields: map[string]string{
+			"tags":     "build, tools",
+			"keywords": "ci",
+		},
+		Docstring: "Build the tools.",
+	}
+	script := Script{Path: "dev/build_tools.py"}
+	header.apply(&script)
+
+	if script.Name != "build_tools" {
+		t.Errorf("name = %q, want file name", script.Name)
+	}
+	if script.Description != "Build the tools." {
+		t.Errorf("description = %q, want docstring", script.Description)
+	}
+	if want := []string{"build", "tools", "ci"}; !reflect.DeepEqual(script.Tags, want) {
+		t.Errorf("tags = %q, want %q", script.Tags, want)
+	}
+}
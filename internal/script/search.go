@@ -0,0 +1,549 @@
+package script
+
+import (
+	"container/heap"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+// 参与搜索的字段，与 scripts.json 中的字段名相同。
+// 标签作为一个字段匹配，匹配范围是在用 ", " 连接后的文本中的位置。
+const (
+	FieldName        = "name"
+	FieldTags        = "tags"
+	FieldCategory    = "category"
+	FieldDescription = "description"
+)
+
+// 各字段匹配的分数权重，名称匹配优先
+const (
+	tagsWeight        = 0.75
+	categoryWeight    = 0.6
+	descriptionWeight = 0.5
+)
+
+// pinyinWeight 拼音匹配的分数权重，同一字段中直接匹配优先于拼音匹配
+const pinyinWeight = 0.9
+
+// SearchResult 搜索结果
+type SearchResult struct {
+	Script Script
+	// Score 匹配分数加上排序方式的加分，越大越靠前；查询中没有文本条件时只有排序加分
+	Score float64
+	// MatchedRanges 匹配到的字符范围，按字段和位置排序，用于高亮显示
+	MatchedRanges []Range
+}
+
+// Ranges 返回字段 field 中匹配到的字符范围
+func (r SearchResult) Ranges(field string) []Range {
+	var ranges []Range
+	for _, rg := range r.MatchedRanges {
+		if rg.Field == field {
+			ranges = append(ranges, rg)
+		}
+	}
+	return ranges
+}
+
+// searchField 参与匹配的字段
+type searchField struct {
+	name   string
+	weight float64
+	text   func(Script) string
+}
+
+var searchFields = [...]searchField{
+	{FieldName, 1, func(s Script) string { return s.Name }},
+	{FieldTags, tagsWeight, func(s Script) string { return strings.Join(s.Tags, ", ") }},
+	{FieldCategory, categoryWeight, func(s Script) string { return s.Category }},
+	{FieldDescription, descriptionWeight, func(s Script) string { return s.Description }},
+}
+
+// fieldText 字段的一种待匹配形式
+type fieldText struct {
+	field  int
+	form   int // 形式的编号，见 formWeights
+	weight float64
+	text   fuzzyText
+}
+
+// formWeights 各种形式的权重。每个字段依次有原文和拼音两种形式，编号为 2*字段 和 2*字段+1，
+// 按编号排列时权重从高到低。
+var formWeights = func() [maxDocTexts]float64 {
+	var weights [maxDocTexts]float64
+	for i, field := range searchFields {
+		weights[2*i] = field.weight
+		weights[2*i+1] = field.weight * pinyinWeight
+	}
+	return weights
+}()
+
+// scriptTexts 返回脚本各字段的待匹配文本，含有汉字的字段额外提供拼音形式，按权重从高到低排列
+func scriptTexts(script Script) []fieldText {
+	texts := make([]fieldText, 0, maxDocTexts)
+	for i, field := range searchFields {
+		value := field.text(script)
+		texts = append(texts, fieldText{i, 2 * i, formWeights[2*i], newFuzzyText(value)})
+		if pinyin, ok := newPinyinText(value); ok {
+			texts = append(texts, fieldText{i, 2*i + 1, formWeights[2*i+1], pinyin})
+		}
+	}
+	sort.SliceStable(texts, func(i, j int) bool { return texts[i].weight > texts[j].weight })
+	return texts
+}
+
+// SearchOption 搜索选项
+type SearchOption func(*searchOptions)
+
+type searchOptions struct {
+	limit  int
+	hidden bool
+}
+
+// WithLimit 最多返回 n 个结果，n 为 0 时不限制。
+// 不限制时要为全部匹配的脚本计算分数和匹配范围，1 万个脚本时需要十几毫秒，
+// 界面随输入搜索时应限制数量。
+func WithLimit(n int) SearchOption {
+	return func(o *searchOptions) {
+		o.limit = n
+	}
+}
+
+// WithHidden 结果中包括隐藏的脚本
+func WithHidden() SearchOption {
+	return func(o *searchOptions) {
+		o.hidden = true
+	}
+}
+
+// Search 按查询搜索脚本，查询语法见 ParseQuery。
+// 自由文本模糊匹配名称、标签、分类和描述，例如 "bldtl" 能匹配 build_tools；
+// 汉字可以用拼音或拼音首字母匹配，例如 "bianyi" 和 "by" 都能匹配“编译”。
+// 置顶的脚本按置顶顺序排在最前面，其余结果按匹配分数排序，分数相同时按配置的排序方式排列；
+// 查询为空时返回全部脚本。隐藏的脚本只在使用 WithHidden 时返回。
+// 查询有语法错误时返回 *SyntaxError。
+func (m *Manager) Search(query string, opts ...SearchOption) ([]SearchResult, error) {
+	m.logger.WithFields(logger.Fields{
+		"query": query,
+	}).Debug("Searching scripts")
+
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return m.SearchQuery(q, opts...), nil
+}
+
+// searchHit 计分阶段的结果
+type searchHit struct {
+	doc     *indexDoc
+	rank    int32 // 在排序中的位置
+	score   float64
+	choices uint64 // 见 matchContext.choices
+}
+
+// better 分数高的在前，分数相同时按排序方式排列
+func (h searchHit) better(other searchHit) bool {
+	if h.score != other.score {
+		return h.score > other.score
+	}
+	return h.rank < other.rank
+}
+
+// SearchQuery 按解析后的查询搜索脚本。
+// 按排序方式依次检查脚本，有文本条件时只检查索引按字符和短语找出的候选脚本。
+// 置顶的脚本排在排序的最前面，匹配的都按顺序放在结果开头；
+// 其余脚本限制结果数量时保留分数最高的结果，排序靠后的脚本加分更少，分数上限不超过已有结果时停止，
+// 单个脚本的分数上限不超过已有结果时跳过；
+// 最后只为返回的结果在计分时选出的形式中计算匹配范围。
+func (m *Manager) SearchQuery(q *Query, opts ...SearchOption) []SearchResult {
+	var o searchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	now := time.Now()
+
+	ix := m.index
+	ranks := ix.rlockRanked(now)
+	defer ix.mu.RUnlock()
+	scratch := ix.scratch.Get().(*searchScratch)
+	defer ix.scratch.Put(scratch)
+
+	pinned := sort.Search(len(ranks), func(i int) bool {
+		return !ix.docs[ranks[i].slot].script.State.Pinned
+	})
+	scored := hasText(q.Expr)
+	var filter *searchFilter
+	if scored {
+		filter = &scratch.filter
+		ix.candidates(filter, q.Expr)
+		ix.rankCandidates(filter, pinned)
+	}
+	bound := maxScore(q.Expr, false)
+
+	c := &matchContext{manager: m, now: now, matcher: &scratch.matcher}
+	var pins []searchHit
+	var hits hitHeap
+	limit := o.limit
+	for i := 0; i < len(ranks); i++ {
+		if scored {
+			// 按排序位置直接跳到下一个候选脚本
+			if i = filter.next(i); i >= len(ranks) {
+				break
+			}
+		}
+		if i == pinned && o.limit > 0 {
+			// 匹配的置顶脚本已占用一部分结果
+			if limit = o.limit - len(pins); limit == 0 {
+				break
+			}
+		}
+		r := &ranks[i]
+		if r.hidden && !o.hidden {
+			continue
+		}
+		if scored {
+			// 置顶脚本之后的位置总会被标记，不一定是候选脚本
+			if filter.slots[r.slot/64]&(1<<(r.slot%64)) == 0 {
+				continue
+			}
+			full := limit > 0 && len(hits) == limit
+			if full && r.boost+bound <= hits[0].score {
+				break
+			}
+			docBound, ok := filter.scoreBound(r.slot)
+			if !ok || full && r.boost+docBound <= hits[0].score {
+				continue
+			}
+		}
+		c.doc = ix.docs[r.slot]
+		hit := searchHit{doc: c.doc, rank: int32(i), score: r.boost}
+		if q.Expr != nil {
+			c.terms, c.choices = 0, 0
+			score, _, ok := c.eval(q.Expr, false)
+			if !ok {
+				continue
+			}
+			hit.score += score
+			hit.choices = c.choices
+		}
+
+		if !scored {
+			// 没有文本条件时分数只来自排序方式，ranks 中的顺序就是结果的顺序
+			hits = append(hits, hit)
+			if len(hits) == o.limit {
+				break
+			}
+			continue
+		}
+		if i < pinned {
+			pins = append(pins, hit)
+			if len(pins) == o.limit {
+				break
+			}
+			continue
+		}
+		if limit == 0 || len(hits) < limit {
+			hits = append(hits, hit)
+			if limit > 0 {
+				heap.Fix(&hits, len(hits)-1)
+			}
+		} else if hit.better(hits[0]) {
+			hits[0] = hit
+			heap.Fix(&hits, 0)
+		}
+	}
+	if scored {
+		sort.Sort(sort.Reverse(hits))
+		hits = append(pins, hits...)
+	}
+
+	results := make([]SearchResult, len(hits))
+	c.withRanges = true
+	for i, hit := range hits {
+		results[i] = SearchResult{Script: hit.doc.script.clone(), Score: hit.score}
+		if scored {
+			c.doc, c.terms, c.choices = hit.doc, 0, hit.choices
+			_, ranges, _ := c.eval(q.Expr, false)
+			results[i].MatchedRanges = normalizeRanges(ranges)
+		}
+	}
+	return results
+}
+
+// maxScore 返回查询中文本条件可能取得的最高分
+func maxScore(expr Expr, negated bool) float64 {
+	switch e := expr.(type) {
+	case *AndExpr:
+		var total float64
+		for _, operand := range e.Operands {
+			total += maxScore(operand, negated)
+		}
+		return total
+	case *NotExpr:
+		return maxScore(e.Operand, !negated)
+	case *TextExpr:
+		if negated {
+			return 0
+		}
+		return float64(e.maxScore)
+	}
+	return 0
+}
+
+// hitHeap 限制结果数量时保存分数最高的结果，堆顶为其中最差的一个
+type hitHeap []searchHit
+
+func (h hitHeap) Len() int            { return len(h) }
+func (h hitHeap) Less(i, j int) bool  { return h[j].better(h[i]) }
+func (h hitHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *hitHeap) Push(x interface{}) { *h = append(*h, x.(searchHit)) }
+func (h *hitHeap) Pop() interface{} {
+	old := *h
+	hit := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return hit
+}
+
+// hasText 判断查询中是否有参与计分的文本条件
+func hasText(expr Expr) bool {
+	switch e := expr.(type) {
+	case *AndExpr:
+		for _, operand := range e.Operands {
+			if hasText(operand) {
+				return true
+			}
+		}
+	case *TextExpr:
+		return true
+	}
+	return false
+}
+
+// extensionLanguages 返回扩展名（不含点，小写）对应的解释器名称
+func (m *Manager) extensionLanguages() map[string][]string {
+	langs := make(map[string][]string)
+	for name, profile := range m.interpreterProfiles() {
+		for _, ext := range profile.Extensions {
+			ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+			langs[ext] = append(langs[ext], name)
+		}
+	}
+	return langs
+}
+
+// matchContext 对一个脚本求值查询
+type matchContext struct {
+	doc        *indexDoc
+	manager    *Manager
+	now        time.Time
+	langs      map[string][]string // 用到 lang 过滤条件时才计算
+	matcher    *fuzzyMatcher
+	withRanges bool // 是否计算匹配范围
+
+	// 计分时依次记录每个文本条件得分最高的形式（下标加一，0 表示不匹配），每个条件 4 位，
+	// 计算匹配范围时直接使用，不再比较各形式的分数
+	choices uint64
+	terms   int // 已求值的文本条件数
+}
+
+// maxChoices matchContext.choices 能记录的文本条件数
+const maxChoices = 16
+
+// eval 返回条件的匹配分数和范围。
+// 被排除的条件只判断是否匹配，普通词也按连续出现判断，避免模糊匹配排除过多脚本。
+func (c *matchContext) eval(expr Expr, negated bool) (float64, []Range, bool) {
+	switch e := expr.(type) {
+	case *AndExpr:
+		var total float64
+		var all []Range
+		for _, operand := range e.Operands {
+			score, ranges, ok := c.eval(operand, negated)
+			if !ok {
+				return 0, nil, false
+			}
+			total += score
+			all = append(all, ranges...)
+		}
+		return total, all, true
+	case *NotExpr:
+		_, _, ok := c.eval(e.Operand, !negated)
+		return 0, nil, !ok
+	case *TextExpr:
+		return c.matchText(e, e.Phrase || negated)
+	case *FilterExpr:
+		return 0, nil, c.filter(e)
+	}
+	return 0, nil, false
+}
+
+// matchText 取分数最高的字段和形式，需要时再计算该形式中的匹配范围。
+func (c *matchContext) matchText(e *TextExpr, exact bool) (float64, []Range, bool) {
+	term := c.terms
+	c.terms++
+	var best float64
+	var bestText int
+	if c.withRanges && term < maxChoices {
+		if bestText = int(c.choices>>(4*term)&15) - 1; bestText < 0 {
+			return 0, nil, false
+		}
+	} else {
+		best, bestText = c.bestText(e, exact)
+		if term < maxChoices {
+			c.choices |= uint64(bestText+1) << (4 * term)
+		}
+		if bestText < 0 {
+			return 0, nil, false
+		}
+		if !c.withRanges {
+			return best, nil, true
+		}
+	}
+
+	text := &c.doc.texts[bestText]
+	var score int
+	var ranges []Range
+	if exact {
+		score, ranges, _ = exactMatch(e.pattern, &text.text)
+	} else {
+		score, ranges, _ = c.matcher.match(e.pattern, &text.text)
+	}
+	for i := range ranges {
+		ranges[i].Field = searchFields[text.field].name
+	}
+	return float64(score) * text.weight, ranges, true
+}
+
+// bestText 返回分数最高的形式及其加权分数，没有匹配的形式时返回 -1。
+// 先用索引中的掩码和字符排除不可能匹配的形式，权重乘以该形式的分数上限不超过已有分数时也跳过。
+func (c *matchContext) bestText(e *TextExpr, exact bool) (float64, int) {
+	best, bestText := 0.0, -1
+	r := &c.doc.summary
+	for i := range r.masks {
+		if !r.mayMatch(i, e) {
+			continue
+		}
+		if bestText >= 0 && best >= r.weights[i]*float64(r.maxScore(i, e.pattern)) {
+			continue
+		}
+		if !exact && !isSubsequence(e.pattern, r.textRunes(i)) {
+			continue
+		}
+		text := &c.doc.texts[i]
+		var score int
+		var ok bool
+		if exact {
+			score, _, ok = exactScore(e.pattern, &text.text)
+		} else {
+			score, ok = c.matcher.score(e.pattern, &text.text)
+		}
+		if !ok {
+			continue
+		}
+		if weighted := float64(score) * text.weight; bestText < 0 || weighted > best {
+			best, bestText = weighted, i
+		}
+	}
+	return best, bestText
+}
+
+func (c *matchContext) filter(e *FilterExpr) bool {
+	script := &c.doc.script
+	switch e.Field {
+	case FilterTag:
+		for _, tag := range c.doc.tags {
+			if strings.EqualFold(tag, e.Value) {
+				return true
+			}
+		}
+		return false
+	case FilterLang:
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(script.Path), "."))
+		if strings.EqualFold(ext, e.Value) || strings.EqualFold(script.Interpreter, e.Value) {
+			return true
+		}
+		if script.Interpreter != "" {
+			return false
+		}
+		if c.langs == nil {
+			c.langs = c.manager.extensionLanguages()
+		}
+		for _, name := range c.langs[ext] {
+			if strings.EqualFold(name, e.Value) {
+				return true
+			}
+		}
+		return false
+	case FilterStatus:
+		if e.Value == StatusNever {
+			return script.State.LastRunTime.IsZero()
+		}
+		return string(script.State.LastStatus) == e.Value
+	case FilterRan:
+		if script.State.LastRunTime.IsZero() {
+			return false
+		}
+		age := c.now.Sub(script.State.LastRunTime)
+		switch e.Op {
+		case "<":
+			return age < e.duration
+		case "<=":
+			return age <= e.duration
+		case ">":
+			return age > e.duration
+		default:
+			return age >= e.duration
+		}
+	case FilterCategory:
+		return inCategory(script.Category, e.Value)
+	case FilterPath:
+		path := strings.ToLower(strings.ReplaceAll(script.Path, "\\", "/"))
+		return strings.Contains(path, strings.ToLower(strings.ReplaceAll(e.Value, "\\", "/")))
+	}
+	return false
+}
+
+// fieldIndex 返回字段在 searchFields 中的位置
+func fieldIndex(name string) int {
+	for i := range searchFields {
+		if searchFields[i].name == name {
+			return i
+		}
+	}
+	return len(searchFields)
+}
+
+// normalizeRanges 按字段和位置排序，合并重叠或相邻的范围
+func normalizeRanges(ranges []Range) []Range {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	less := func(a, b Range) bool {
+		if a.Field != b.Field {
+			return fieldIndex(a.Field) < fieldIndex(b.Field)
+		}
+		return a.Start < b.Start
+	}
+	for i := 1; i < len(ranges); i++ {
+		// 只有一个条件时范围通常已经有序
+		if less(ranges[i], ranges[i-1]) {
+			sort.Slice(ranges, func(i, j int) bool { return less(ranges[i], ranges[j]) })
+			break
+		}
+	}
+
+	merged := ranges[:1]
+	for _, rg := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if rg.Field == last.Field && rg.Start <= last.End {
+			last.End = max(last.End, rg.End)
+			continue
+		}
+		merged = append(merged, rg)
+	}
+	return merged
+}
@@ -0,0 +1,172 @@
+package script
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yahao333/x-script/pkg/config"
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+var (
+	benchWords = []string{
+		"build", "tools", "deploy", "backend", "frontend", "ocr", "image", "sync",
+		"backup", "report", "daily", "clean", "cache", "docker", "release", "test",
+		"lint", "format", "proto", "gen", "db", "migrate", "log", "upload",
+		"api", "auth", "billing", "cluster", "config", "cron", "export", "fetch",
+		"gateway", "import", "index", "jenkins", "kafka", "metrics", "mirror", "monitor",
+		"nginx", "notify", "orders", "payment", "queue", "redis", "rotate", "schema",
+		"search", "secrets", "server", "shard", "snapshot", "ssl", "stats", "storage",
+		"sweep", "template", "token", "trace", "user", "vendor", "verify", "worker",
+	}
+	benchChinese = []string{
+		"编译", "部署", "工具", "识别", "同步", "备份", "清理", "日志", "上传", "测试", "数据库", "报表",
+		"监控", "告警", "订单", "支付", "用户", "缓存", "证书", "镜像", "索引", "导出", "迁移", "统计",
+	}
+	benchExts = []string{".py", ".sh", ".js", ".ps1", ".go"}
+)
+
+// benchmarkScripts 生成 n 个脚本，名称和描述由常见的单词和中文词组成，部分脚本有运行记录
+func benchmarkScripts(n int) []Script {
+	rng := rand.New(rand.NewSource(1))
+	word := func(words []string) string { return words[rng.Intn(len(words))] }
+	now := time.Now()
+
+	scripts := make([]Script, n)
+	for i := range scripts {
+		name := fmt.Sprintf("%s_%s_%d", word(benchWords), word(benchWords), i)
+		dir := word(benchWords)
+		scripts[i] = Script{
+			ID:          fmt.Sprintf("%s/%s", dir, name),
+			Name:        name,
+			Path:        fmt.Sprintf("%s/%s%s", dir, name, word(benchExts)),
+			Description: fmt.Sprintf("%s%s-%s的%s", word(benchChinese), word(benchWords), word(benchWords), word(benchChinese)),
+			Tags:        []string{word(benchWords), word(benchWords)},
+			Category:    dir + "/" + word(benchWords),
+		}
+		if rng.Intn(3) == 0 {
+			state := &scripts[i].State
+			state.LastRunTime = now.Add(-time.Duration(rng.Intn(30*24)) * time.Hour)
+			state.LastStatus = RunSucceeded
+			if rng.Intn(4) == 0 {
+				state.LastStatus = RunFailed
+			}
+			state.RunCount = 1 + rng.Intn(50)
+			state.bumpFrecency(state.LastRunTime)
+		}
+	}
+	return scripts
+}
+
+func benchmarkManager(b *testing.B, n int) *Manager {
+	b.Helper()
+	cfg := config.DefaultConfig
+	cfg.LogLevel = "error"
+	log, err := logger.New(&cfg, b.TempDir(), logger.WithoutConsole())
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := NewManager(&cfg, log)
+	m.replaceCatalog(benchmarkScripts(n), nil)
+	return m
+}
+
+// benchmarkLimit 界面上显示的结果数量
+const benchmarkLimit = 100
+
+// BenchmarkSearch 每次按键执行一次搜索，10k 个脚本时每次搜索应在 1ms 以内
+func BenchmarkSearch(b *testing.B) {
+	queries := []string{
+		"",
+		"b",
+		"bld",
+		"bldtl",
+		"deploy backend",
+		"by",
+		"bianyi",
+		`"backend-proto"`,
+		"tag:docker",
+		"category:ocr",
+		"lang:py status:failed",
+		"ran:<7d -tag:test",
+		"sync -lint",
+	}
+	for _, n := range []int{1000, 10000} {
+		m := benchmarkManager(b, n)
+		for _, query := range queries {
+			b.Run(fmt.Sprintf("n=%d/%s", n, query), func(b *testing.B) {
+				benchmarkSearch(b, m, query, WithLimit(benchmarkLimit))
+			})
+		}
+	}
+}
+
+// BenchmarkSearchAll 返回全部结果，不限制数量
+func BenchmarkSearchAll(b *testing.B) {
+	m := benchmarkManager(b, 10000)
+	for _, query := range []string{"", "b", "bldtl", "tag:docker"} {
+		b.Run(query, func(b *testing.B) {
+			benchmarkSearch(b, m, query)
+		})
+	}
+}
+
+func benchmarkSearch(b *testing.B, m *Manager, query string, opts ...SearchOption) {
+	b.ReportAllocs()
+	var results int
+	for i := 0; i < b.N; i++ {
+		found, err := m.Search(query, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		results = len(found)
+	}
+	b.ReportMetric(float64(results), "results")
+}
+
+// BenchmarkIndexUpdate 运行结束后更新一个脚本的状态，然后搜索
+func BenchmarkIndexUpdate(b *testing.B) {
+	m := benchmarkManager(b, 10000)
+	scripts := m.GetScripts()
+	if _, err := m.Search(""); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		script := scripts[i%len(scripts)]
+		script.State.bumpFrecency(time.Now())
+		m.index.update(script)
+		if _, err := m.Search("bld", WithLimit(benchmarkLimit)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkIndexReload 重新加载脚本目录，其中一个脚本的描述被修改
+func BenchmarkIndexReload(b *testing.B) {
+	m := benchmarkManager(b, 10000)
+	scripts := m.GetScripts()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := i % len(scripts)
+		scripts[k].Description = strings.Repeat("x", i%7) + scripts[k].Description
+		m.index.replace(scripts)
+	}
+}
+
+// BenchmarkIndexBuild 首次加载时建立索引
+func BenchmarkIndexBuild(b *testing.B) {
+	m := benchmarkManager(b, 0)
+	scripts := benchmarkScripts(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ix := newSearchIndex(m.rankingLess, m.rankingBoost)
+		ix.replace(scripts)
+	}
+}
@@ -0,0 +1,608 @@
+package script
+
+import (
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// boostRefreshInterval 结果排序加分的缓存时间。频率分数的半衰期为一周，一分钟内的变化可以忽略
+const boostRefreshInterval = time.Minute
+
+// gram 索引中的键，为连续的三个字符
+type gram uint64
+
+func trigram(a, b, c rune) gram {
+	return gram(a)<<42 | gram(b)<<21 | gram(c)
+}
+
+// maxDocTexts 一个脚本最多的待匹配形式数，每个字段有原文和拼音两种形式
+const maxDocTexts = 2 * len(searchFields)
+
+// docSummary 脚本各形式的掩码和字符，与 indexDoc.texts 的顺序相同，未使用的形式掩码为零。
+// 计算分数上限和排除单个形式时只读取它，不必读取分散在内存中的文本。
+type docSummary struct {
+	masks   [maxDocTexts]uint64    // 出现过的字符
+	pairs   [maxDocTexts][2]uint64 // 先后出现的字符对
+	heads   [maxDocTexts]uint64    // 出现在单词开头（有位置加分）的字符
+	weights [maxDocTexts]float64
+	ends    [maxDocTexts]int32 // 各形式的字符在 runes 中的结束位置
+	runes   []rune             // 各形式的字符依次相连，与 indexDoc.texts 共用
+}
+
+// newDocSummary 计算各形式的掩码，并把各形式的字符移到同一块连续的内存中
+func newDocSummary(texts []fieldText) docSummary {
+	total := 0
+	for _, text := range texts {
+		total += len(text.text.runes)
+	}
+	s := docSummary{runes: make([]rune, 0, total)}
+	for i := range texts {
+		text := &texts[i].text
+		for k, r := range text.runes {
+			s.masks[i] |= runeMask(r)
+			if text.bonus[k] > 0 {
+				s.heads[i] |= runeMask(r)
+			}
+		}
+		s.pairs[i] = pairMask(text.runes)
+		s.weights[i] = texts[i].weight
+
+		start := len(s.runes)
+		s.runes = append(s.runes, text.runes...)
+		s.ends[i] = int32(len(s.runes))
+		text.runes = s.runes[start:len(s.runes):len(s.runes)]
+	}
+	return s
+}
+
+// mayMatch 判断 e 是否可能匹配第 i 种形式，返回 false 时一定不匹配
+func (s *docSummary) mayMatch(i int, e *TextExpr) bool {
+	if mask := s.masks[i]; mask == 0 || mask&e.mask != e.mask {
+		return false
+	}
+	pairs := &s.pairs[i]
+	return pairs[0]&e.pairs[0] == e.pairs[0] && pairs[1]&e.pairs[1] == e.pairs[1]
+}
+
+// maxScore 返回 pattern 在第 i 种形式中可能取得的最高分（未乘权重），不小于实际的最高分
+func (s *docSummary) maxScore(i int, pattern []rune) int {
+	return maxMatchScore(s.heads[i], pattern)
+}
+
+// textRunes 返回第 i 种形式的字符
+func (s *docSummary) textRunes(i int) []rune {
+	start := int32(0)
+	if i > 0 {
+		start = s.ends[i-1]
+	}
+	return s.runes[start:s.ends[i]]
+}
+
+// rankedDoc 按排序方式排列的一个脚本，搜索时按顺序读取
+type rankedDoc struct {
+	slot   int32
+	hidden bool
+	boost  float64 // 排序方式对分数的加分
+}
+
+// filterBits 每种形式在 searchIndex.filter 中占用的位数：字符掩码 64 位，字符对掩码 128 位，
+// 出现在单词开头的字符的掩码 64 位
+const filterBits = 64 + 128 + 64
+
+// headBits 单词开头的字符的掩码在每种形式中的起始位置
+const headBits = 64 + 128
+
+// searchFilter 用索引求出的一次搜索的候选槽位
+type searchFilter struct {
+	slots []uint64 // 可能满足全部文本条件的槽位的位图
+	ranks []uint64 // 同样的候选脚本，按排序中的位置
+	texts []textFilter
+	buf   []uint64 // 位图的缓冲区，每次搜索复用
+}
+
+// bitmap 从缓冲区中取出一个清零的位图
+func (f *searchFilter) bitmap(words int) []uint64 {
+	if len(f.buf)+words > cap(f.buf) {
+		f.buf = make([]uint64, 0, 2*cap(f.buf)+words)
+	}
+	n := len(f.buf)
+	f.buf = f.buf[:n+words]
+	bitmap := f.buf[n : n+words : n+words]
+	clear(bitmap)
+	return bitmap
+}
+
+// textFilter 一个计分的文本条件在各种形式中可能匹配的槽位，下标为形式的编号
+type textFilter struct {
+	expr  *TextExpr
+	forms [maxDocTexts][]uint64
+	runes []uint64                // pattern 中不同字符的掩码
+	heads [maxDocTexts][][]uint64 // runes 中的字符在各种形式中出现在单词开头的槽位
+}
+
+// scoreBound 返回槽位中的脚本可能取得的最高匹配分数，确定不匹配时返回 false。
+// 只读取位图，与逐个形式调用 docSummary.mayMatch 和 maxScore 的结果相同。
+func (f *searchFilter) scoreBound(slot int32) (float64, bool) {
+	word, shift := slot/64, uint(slot%64)
+	var total float64
+	for k := range f.texts {
+		t := &f.texts[k]
+		// 先取出可能匹配的形式，避免逐个形式判断
+		var forms uint
+		for form, bitmap := range &t.forms {
+			forms |= uint(bitmap[word]>>shift&1) << form
+		}
+		if forms == 0 {
+			return 0, false
+		}
+		best := -1.0
+		for ; forms != 0; forms &= forms - 1 {
+			form := bits.TrailingZeros(forms)
+			// 形式按权重从高到低排列，后面的形式不可能超过已有的上限
+			if best >= formWeights[form]*float64(t.expr.maxScore) {
+				break
+			}
+			// maxMatchScore 只用到 pattern 中的字符是否在单词开头
+			var heads uint64
+			for j, bitmap := range t.heads[form] {
+				heads |= t.runes[j] & -(bitmap[word] >> shift & 1)
+			}
+			best = max(best, formWeights[form]*float64(maxMatchScore(heads, t.expr.pattern)))
+		}
+		total += best
+	}
+	return total, true
+}
+
+// indexDoc 索引中的一个脚本，预先计算好待匹配的文本
+type indexDoc struct {
+	script  Script
+	pos     int // 在脚本目录中的位置
+	texts   []fieldText
+	summary docSummary
+	tags    []string // 小写的标签
+	grams   []gram
+}
+
+func newIndexDoc(script Script, pos int) *indexDoc {
+	doc := &indexDoc{
+		script: script,
+		pos:    pos,
+		texts:  scriptTexts(script),
+	}
+	doc.summary = newDocSummary(doc.texts)
+	for _, tag := range script.Tags {
+		doc.tags = append(doc.tags, strings.ToLower(tag))
+	}
+
+	for _, text := range doc.texts {
+		runes := text.text.runes
+		for i := 2; i < len(runes); i++ {
+			doc.grams = append(doc.grams, trigram(runes[i-2], runes[i-1], runes[i]))
+		}
+	}
+	doc.grams = uniqueGrams(doc.grams)
+	return doc
+}
+
+func uniqueGrams(grams []gram) []gram {
+	sort.Slice(grams, func(i, j int) bool { return grams[i] < grams[j] })
+	unique := grams[:0]
+	for i, g := range grams {
+		if i == 0 || g != grams[i-1] {
+			unique = append(unique, g)
+		}
+	}
+	return unique
+}
+
+// searchIndex 搜索索引。
+// 每个脚本占用一个固定的槽位，postings 记录每个三字组出现在哪些槽位中，用于查找短语；
+// filter 按形式和掩码中的位记录槽位的位图，与 docSummary.mayMatch 的判断相同，
+// 搜索时按词中的字符和字符对求交集，一次排除不可能匹配的脚本，再用其中单词开头的字符计算分数上限，
+// 只有可能进入结果的脚本才读取 indexDoc。
+// ranks 按排序方式排列槽位，脚本目录变化时只重新索引文本有变化的脚本，运行状态变化时只移动该脚本在排序中的位置。
+// 搜索依次进行，匹配时复用同一个缓冲区。
+type searchIndex struct {
+	// 搜索持有读锁，可以同时进行；修改索引和重新排序持有写锁
+	mu       sync.RWMutex
+	docs     []*indexDoc // 按槽位，nil 表示空闲
+	free     []int32
+	slots    map[string]int32 // 脚本 ID 到槽位
+	postings map[gram][]int32 // 有序的槽位
+	filter   [][]uint64       // 编号为 f 的形式的第 b 位在 filter[f*filterBits+b] 中，每个槽位一位
+	scratch  sync.Pool        // *searchScratch
+
+	// 排序方式
+	less  func(now time.Time) func(a, b Script) bool
+	boost func(now time.Time) func(Script) float64
+
+	ranks    []rankedDoc // 为 nil 时需要重新排序
+	rankOf   []int32     // 按槽位，脚本在 ranks 中的位置
+	rankedAt time.Time
+}
+
+func newSearchIndex(less func(time.Time) func(a, b Script) bool, boost func(time.Time) func(Script) float64) *searchIndex {
+	return &searchIndex{
+		slots:    make(map[string]int32),
+		postings: make(map[gram][]int32),
+		filter:   make([][]uint64, maxDocTexts*filterBits),
+		scratch:  sync.Pool{New: func() interface{} { return new(searchScratch) }},
+		less:     less,
+		boost:    boost,
+	}
+}
+
+// searchScratch 一次搜索使用的缓冲区，在搜索之间复用
+type searchScratch struct {
+	filter  searchFilter
+	matcher fuzzyMatcher
+}
+
+// replace 用新的脚本目录更新索引
+func (ix *searchIndex) replace(scripts []Script) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	seen := make(map[string]struct{}, len(scripts))
+	for pos, script := range scripts {
+		seen[script.ID] = struct{}{}
+		ix.put(script, pos)
+	}
+	for id, slot := range ix.slots {
+		if _, ok := seen[id]; !ok {
+			ix.unpost(slot, ix.docs[slot].grams)
+			ix.setFilter(slot, ix.docs[slot], false)
+			ix.docs[slot] = nil
+			ix.free = append(ix.free, slot)
+			delete(ix.slots, id)
+		}
+	}
+	ix.ranks = nil
+}
+
+// update 更新一个脚本，脚本不在索引中时不做任何事
+func (ix *searchIndex) update(script Script) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	slot, ok := ix.slots[script.ID]
+	if !ok {
+		return
+	}
+	rank := int(ix.rankOf[slot])
+	ix.put(script, ix.docs[slot].pos)
+	if ix.ranks == nil {
+		return
+	}
+
+	// 运行状态可能改变了排序，在去掉该脚本后的顺序中查找新位置，只移动两个位置之间的脚本
+	doc := ix.docs[slot]
+	less := ix.rankLess(time.Now())
+	ranks := ix.ranks
+	i := sort.Search(len(ranks)-1, func(k int) bool {
+		if k >= rank {
+			k++
+		}
+		return less(doc, ix.docs[ranks[k].slot])
+	})
+	if i < rank {
+		copy(ranks[i+1:rank+1], ranks[i:rank])
+	} else {
+		copy(ranks[rank:i], ranks[rank+1:i+1])
+	}
+	ranks[i] = ix.rankedDoc(slot, ix.boost(ix.rankedAt))
+	for k := min(i, rank); k <= max(i, rank); k++ {
+		ix.rankOf[ranks[k].slot] = int32(k)
+	}
+}
+
+func (ix *searchIndex) put(script Script, pos int) {
+	slot, ok := ix.slots[script.ID]
+	if ok {
+		doc := ix.docs[slot]
+		if sameSearchText(doc.script, script) {
+			doc.script, doc.pos = script, pos
+			return
+		}
+		ix.unpost(slot, doc.grams)
+		ix.setFilter(slot, doc, false)
+	} else if n := len(ix.free); n > 0 {
+		slot = ix.free[n-1]
+		ix.free = ix.free[:n-1]
+	} else {
+		slot = int32(len(ix.docs))
+		ix.docs = append(ix.docs, nil)
+		ix.rankOf = append(ix.rankOf, 0)
+		if int(slot)/64 == len(ix.filter[0]) {
+			for i := range ix.filter {
+				ix.filter[i] = append(ix.filter[i], 0)
+			}
+		}
+	}
+
+	doc := newIndexDoc(script, pos)
+	ix.docs[slot] = doc
+	ix.slots[script.ID] = slot
+	ix.post(slot, doc.grams)
+	ix.setFilter(slot, doc, true)
+}
+
+// setFilter 在 filter 中设置或清除脚本各形式的掩码对应的位
+func (ix *searchIndex) setFilter(slot int32, doc *indexDoc, on bool) {
+	word, bit := slot/64, uint64(1)<<(slot%64)
+	s := &doc.summary
+	for i, text := range doc.texts {
+		masks := [4]uint64{s.masks[i], s.pairs[i][0], s.pairs[i][1], s.heads[i]}
+		for k, mask := range masks {
+			for ; mask != 0; mask &= mask - 1 {
+				bitmap := ix.filter[text.form*filterBits+k*64+bits.TrailingZeros64(mask)]
+				if on {
+					bitmap[word] |= bit
+				} else {
+					bitmap[word] &^= bit
+				}
+			}
+		}
+	}
+}
+
+// sameSearchText 判断两个脚本参与匹配的文本是否相同
+func sameSearchText(a, b Script) bool {
+	for _, field := range searchFields {
+		if field.text(a) != field.text(b) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ix *searchIndex) post(slot int32, grams []gram) {
+	for _, g := range grams {
+		list := ix.postings[g]
+		i := sort.Search(len(list), func(i int) bool { return list[i] >= slot })
+		if i == len(list) {
+			ix.postings[g] = append(list, slot)
+			continue
+		}
+		list = append(list, 0)
+		copy(list[i+1:], list[i:])
+		list[i] = slot
+		ix.postings[g] = list
+	}
+}
+
+func (ix *searchIndex) unpost(slot int32, grams []gram) {
+	for _, g := range grams {
+		list := ix.postings[g]
+		i := sort.Search(len(list), func(i int) bool { return list[i] >= slot })
+		if i == len(list) || list[i] != slot {
+			continue
+		}
+		if len(list) == 1 {
+			delete(ix.postings, g)
+			continue
+		}
+		ix.postings[g] = append(list[:i], list[i+1:]...)
+	}
+}
+
+// rankLess 返回排序方式的比较函数，先后相同时按脚本目录中的位置排列
+func (ix *searchIndex) rankLess(now time.Time) func(a, b *indexDoc) bool {
+	less := ix.less(now)
+	return func(a, b *indexDoc) bool {
+		if less != nil {
+			if less(a.script, b.script) {
+				return true
+			}
+			if less(b.script, a.script) {
+				return false
+			}
+		}
+		return a.pos < b.pos
+	}
+}
+
+// rlockRanked 获取读锁并返回按排序方式排列的脚本，需要重新排序时先短暂持有写锁。
+// 调用方用完后需释放读锁。
+func (ix *searchIndex) rlockRanked(now time.Time) []rankedDoc {
+	ix.mu.RLock()
+	for ix.ranks == nil || now.Sub(ix.rankedAt) >= boostRefreshInterval {
+		ix.mu.RUnlock()
+		ix.mu.Lock()
+		ix.ranked(now)
+		ix.mu.Unlock()
+		ix.mu.RLock()
+	}
+	return ix.ranks
+}
+
+// ranked 按排序方式排列脚本，调用方需持有写锁。
+// 各种排序方式的先后关系不随时间变化（频率分数按相同的比例衰减），只在脚本目录变化后重新排序；
+// 加分随时间变化，定期重新计算。
+func (ix *searchIndex) ranked(now time.Time) {
+	if ix.ranks == nil {
+		order := make([]int32, 0, len(ix.slots))
+		for _, slot := range ix.slots {
+			order = append(order, slot)
+		}
+		less := ix.rankLess(now)
+		sort.Slice(order, func(i, j int) bool {
+			return less(ix.docs[order[i]], ix.docs[order[j]])
+		})
+		ix.ranks = make([]rankedDoc, len(order))
+		for rank, slot := range order {
+			ix.rankOf[slot] = int32(rank)
+			ix.ranks[rank].slot = slot
+		}
+	} else if now.Sub(ix.rankedAt) < boostRefreshInterval {
+		return
+	}
+
+	boost := ix.boost(now)
+	for i := range ix.ranks {
+		ix.ranks[i] = ix.rankedDoc(ix.ranks[i].slot, boost)
+	}
+	ix.rankedAt = now
+}
+
+func (ix *searchIndex) rankedDoc(slot int32, boost func(Script) float64) rankedDoc {
+	script := &ix.docs[slot].script
+	return rankedDoc{slot: slot, hidden: script.State.Hidden, boost: boost(*script)}
+}
+
+// candidates 在 f 中找出查询中计分的文本条件的候选槽位，查询中需要有文本条件
+func (ix *searchIndex) candidates(f *searchFilter, expr Expr) {
+	f.slots, f.texts, f.buf = nil, f.texts[:0], f.buf[:0]
+	ix.addCandidates(f, expr)
+}
+
+// rankCandidates 把候选槽位转换为排序中的位置，另外标记位置 stop，需要先调用 ranked
+func (ix *searchIndex) rankCandidates(f *searchFilter, stop int) {
+	f.ranks = f.bitmap((len(ix.ranks) + 63) / 64)
+	for w, x := range f.slots {
+		for ; x != 0; x &= x - 1 {
+			rank := ix.rankOf[w*64+bits.TrailingZeros64(x)]
+			f.ranks[rank/64] |= 1 << (rank % 64)
+		}
+	}
+	if stop < len(ix.ranks) {
+		f.ranks[stop/64] |= 1 << (stop % 64)
+	}
+}
+
+// next 返回从 i 开始第一个标记的位置，没有时返回的位置不小于脚本数量
+func (f *searchFilter) next(i int) int {
+	w := i / 64
+	if w >= len(f.ranks) {
+		return i
+	}
+	x := f.ranks[w] >> (i % 64) << (i % 64)
+	for x == 0 {
+		if w++; w == len(f.ranks) {
+			return w * 64
+		}
+		x = f.ranks[w]
+	}
+	return w*64 + bits.TrailingZeros64(x)
+}
+
+func (ix *searchIndex) addCandidates(f *searchFilter, expr Expr) {
+	switch e := expr.(type) {
+	case *AndExpr:
+		for _, operand := range e.Operands {
+			ix.addCandidates(f, operand)
+		}
+	case *TextExpr:
+		t := textFilter{expr: e}
+		slots := ix.filterText(f, &t)
+		if e.Phrase && len(e.pattern) >= 3 {
+			grams := make([]gram, 0, len(e.pattern)-2)
+			for i := 2; i < len(e.pattern); i++ {
+				grams = append(grams, trigram(e.pattern[i-2], e.pattern[i-1], e.pattern[i]))
+			}
+			phrase := f.bitmap(len(slots))
+			for _, slot := range ix.lookup(uniqueGrams(grams)) {
+				phrase[slot/64] |= 1 << (slot % 64)
+			}
+			for w := range slots {
+				slots[w] &= phrase[w]
+			}
+		}
+		f.texts = append(f.texts, t)
+		if f.slots == nil {
+			f.slots = slots
+			return
+		}
+		for w := range f.slots {
+			f.slots[w] &= slots[w]
+		}
+	}
+	// 排除条件不计分，过滤条件在匹配时判断，都不用索引缩小范围
+}
+
+// filterText 计算 t 中每种形式可能匹配的槽位，与对每种形式调用 docSummary.mayMatch 的结果相同；
+// 返回至少有一种形式可能匹配的槽位
+func (ix *searchIndex) filterText(f *searchFilter, t *textFilter) []uint64 {
+	var offsets []int
+	masks := [3]uint64{t.expr.mask, t.expr.pairs[0], t.expr.pairs[1]}
+	for k, mask := range masks {
+		for ; mask != 0; mask &= mask - 1 {
+			offsets = append(offsets, k*64+bits.TrailingZeros64(mask))
+		}
+	}
+
+	words := len(ix.filter[0])
+	result := f.bitmap(words)
+	for form := range t.forms {
+		bitmaps := ix.filter[form*filterBits : (form+1)*filterBits]
+		bitmap := f.bitmap(words)
+		for w := range bitmap {
+			x := ^uint64(0)
+			for _, b := range offsets {
+				if x &= bitmaps[b][w]; x == 0 {
+					break
+				}
+			}
+			bitmap[w] = x
+			result[w] |= x
+		}
+		t.forms[form] = bitmap
+	}
+
+	for mask := t.expr.mask; mask != 0; mask &= mask - 1 {
+		b := bits.TrailingZeros64(mask)
+		t.runes = append(t.runes, 1<<b)
+		for form := range t.heads {
+			t.heads[form] = append(t.heads[form], ix.filter[form*filterBits+headBits+b])
+		}
+	}
+	return result
+}
+
+// lookup 返回包含全部键的槽位
+func (ix *searchIndex) lookup(grams []gram) []int32 {
+	lists := make([][]int32, 0, len(grams))
+	for _, g := range grams {
+		list, ok := ix.postings[g]
+		if !ok {
+			return nil
+		}
+		lists = append(lists, list)
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+	// 从最短的列表开始求交集
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	result := append([]int32(nil), lists[0]...)
+	for _, list := range lists[1:] {
+		result = intersectSlots(result, list)
+		if len(result) == 0 {
+			break
+		}
+	}
+	return result
+}
+
+// intersectSlots 求两个有序列表的交集，结果写入 a
+func intersectSlots(a, b []int32) []int32 {
+	result := a[:0]
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,291 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bruteForceSearch 不使用索引，逐个脚本完整地求值查询，返回不限制数量时的全部结果。
+// docs 按脚本目录中的顺序排列，限制数量时的结果是其中的前几个。
+func bruteForceSearch(m *Manager, docs []*indexDoc, q *Query, hidden bool) []SearchResult {
+	now := time.Now()
+	less := m.rankingLess(now)
+	boost := m.rankingBoost(now)
+
+	order := make([]int, len(docs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return less(docs[order[i]].script, docs[order[j]].script)
+	})
+
+	type hit struct {
+		result SearchResult
+		rank   int
+	}
+	var pins, hits []hit
+	fm := &fuzzyMatcher{}
+	for rank, pos := range order {
+		script := docs[pos].script
+		if script.State.Hidden && !hidden {
+			continue
+		}
+		c := &matchContext{manager: m, now: now, doc: docs[pos]}
+		score, ranges, ok := bruteForceEval(c, fm, q.Expr, false)
+		if !ok {
+			continue
+		}
+		h := hit{SearchResult{Script: script, Score: boost(script) + score, MatchedRanges: normalizeRanges(ranges)}, rank}
+		if script.State.Pinned || !hasText(q.Expr) {
+			pins = append(pins, h)
+		} else {
+			hits = append(hits, h)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].result.Score != hits[j].result.Score {
+			return hits[i].result.Score > hits[j].result.Score
+		}
+		return hits[i].rank < hits[j].rank
+	})
+
+	var results []SearchResult
+	for _, h := range append(pins, hits...) {
+		results = append(results, h.result)
+	}
+	return results
+}
+
+// bruteForceEval 对脚本的每种形式都完整地计算匹配分数，取最高分
+func bruteForceEval(c *matchContext, fm *fuzzyMatcher, expr Expr, negated bool) (float64, []Range, bool) {
+	switch e := expr.(type) {
+	case nil:
+		return 0, nil, true
+	case *AndExpr:
+		var total float64
+		var all []Range
+		for _, operand := range e.Operands {
+			score, ranges, ok := bruteForceEval(c, fm, operand, negated)
+			if !ok {
+				return 0, nil, false
+			}
+			total += score
+			all = append(all, ranges...)
+		}
+		return total, all, true
+	case *NotExpr:
+		_, _, ok := bruteForceEval(c, fm, e.Operand, !negated)
+		return 0, nil, !ok
+	case *FilterExpr:
+		return 0, nil, c.filter(e)
+	case *TextExpr:
+		exact := e.Phrase || negated
+		best, found := 0.0, false
+		var bestRanges []Range
+		for _, text := range c.doc.texts {
+			var score int
+			var ranges []Range
+			var ok bool
+			if exact {
+				score, ranges, ok = exactMatch(e.pattern, &text.text)
+			} else {
+				score, ranges, ok = fm.match(e.pattern, &text.text)
+			}
+			if !ok {
+				continue
+			}
+			if weighted := float64(score) * text.weight; !found || weighted > best {
+				best, found = weighted, true
+				bestRanges = ranges
+				for i := range bestRanges {
+					bestRanges[i].Field = searchFields[text.field].name
+				}
+			}
+		}
+		return best, bestRanges, found
+	}
+	return 0, nil, false
+}
+
+var equivalenceQueries = []string{
+	"",
+	"b",
+	"bld",
+	"bldtl",
+	"deploy backend",
+	"by",
+	"bianyi",
+	"bygj",
+	"编译",
+	`"backend-proto"`,
+	`"的" sync`,
+	`"zzzz"`,
+	"tag:docker",
+	"category:ocr",
+	"lang:py status:failed",
+	"ran:<7d -tag:test",
+	"sync -lint",
+	"-b",
+	`-"deploy" api`,
+	"status:never ocr",
+	"path:sync tl",
+	"qqqq",
+	"x y z",
+}
+
+// checkSearchEquivalence 比较索引搜索和逐个脚本求值的结果
+func checkSearchEquivalence(t *testing.T, m *Manager, scripts []Script) {
+	t.Helper()
+	docs := make([]*indexDoc, len(scripts))
+	for pos, script := range scripts {
+		docs[pos] = newIndexDoc(script, pos)
+	}
+	for _, query := range equivalenceQueries {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("parse %q: %v", query, err)
+		}
+		all := map[bool][]SearchResult{
+			false: bruteForceSearch(m, docs, q, false),
+			true:  bruteForceSearch(m, docs, q, true),
+		}
+		for _, o := range []searchOptions{{}, {limit: 1}, {limit: 20}, {limit: 100}, {limit: 20, hidden: true}} {
+			opts := []SearchOption{WithLimit(o.limit)}
+			if o.hidden {
+				opts = append(opts, WithHidden())
+			}
+			got := m.SearchQuery(q, opts...)
+			want := all[o.hidden]
+			if o.limit > 0 && len(want) > o.limit {
+				want = want[:o.limit]
+			}
+			if msg := diffResults(got, want); msg != "" {
+				t.Errorf("query %q limit %d hidden %v: %s", query, o.limit, o.hidden, msg)
+			}
+		}
+	}
+}
+
+func diffResults(got, want []SearchResult) string {
+	if len(got) != len(want) {
+		return fmt.Sprintf("got %d results, want %d", len(got), len(want))
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if g.Script.ID != w.Script.ID {
+			return fmt.Sprintf("result %d is %s (%.4f), want %s (%.4f)", i, g.Script.ID, g.Score, w.Script.ID, w.Score)
+		}
+		// 排序加分按时间衰减，两次计算的时间不同
+		if math.Abs(g.Score-w.Score) > 1e-3 {
+			return fmt.Sprintf("result %d (%s) score %v, want %v", i, g.Script.ID, g.Score, w.Score)
+		}
+		if !reflect.DeepEqual(g.MatchedRanges, w.MatchedRanges) {
+			return fmt.Sprintf("result %d (%s) ranges %v, want %v", i, g.Script.ID, g.MatchedRanges, w.MatchedRanges)
+		}
+	}
+	return ""
+}
+
+func TestSearchIndexEquivalence(t *testing.T) {
+	scripts := benchmarkScripts(2000)
+	// 部分脚本置顶或隐藏
+	for i := 0; i < len(scripts); i += 97 {
+		scripts[i].State.Pinned = true
+		scripts[i].State.PinOrder = len(scripts) - i
+	}
+	for i := 5; i < len(scripts); i += 31 {
+		scripts[i].State.Hidden = true
+	}
+	// 错开频率分数，避免接近相等的分数随计算时间的衰减交换顺序
+	for i := range scripts {
+		scripts[i].State.Frecency += float64(i) / 100
+	}
+
+	for _, ranking := range []string{RankingFrecency, RankingRecent, RankingAlphabetical, RankingManual} {
+		t.Run(ranking, func(t *testing.T) {
+			m := newTestManager(t)
+			m.config.Ranking = ranking
+			scripts := append([]Script(nil), scripts...)
+			m.replaceCatalog(scripts, nil)
+			checkSearchEquivalence(t, m, scripts)
+
+			// 运行后只更新脚本在排序中的位置
+			now := time.Now()
+			for i := 0; i < len(scripts); i += 53 {
+				scripts[i].State.LastRunTime = now.Add(-time.Duration(i) * time.Minute)
+				scripts[i].State.LastStatus = RunFailed
+				scripts[i].State.bumpFrecency(scripts[i].State.LastRunTime)
+				m.index.update(scripts[i])
+			}
+			checkSearchEquivalence(t, m, scripts)
+
+			// 重新加载：修改文本、删除和添加脚本，槽位会被复用
+			for i := 0; i < len(scripts); i += 41 {
+				scripts[i].Description = "编译 deploy " + scripts[i].Description
+				scripts[i].Tags = append(scripts[i].Tags, "docker")
+			}
+			added := benchmarkScripts(2300)[2000:]
+			for i := range added {
+				added[i].ID = "added/" + added[i].ID
+				added[i].State.Frecency += float64(i)/100 + 0.005
+			}
+			scripts = append(scripts[300:], added...)
+			m.replaceCatalog(scripts, nil)
+			checkSearchEquivalence(t, m, scripts)
+		})
+	}
+}
+
+func TestConcurrentSearch(t *testing.T) {
+	m := newTestManager(t)
+	scripts := benchmarkScripts(500)
+	m.replaceCatalog(scripts, nil)
+
+	want := make(map[string][]SearchResult)
+	for _, query := range equivalenceQueries {
+		results, err := m.Search(query, WithLimit(20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[query] = results
+	}
+
+	// 多个搜索同时进行时结果不变
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, query := range equivalenceQueries {
+				results, _ := m.Search(query, WithLimit(20))
+				if diff := diffResults(results, want[query]); diff != "" {
+					t.Errorf("concurrent Search(%q): %s", query, diff)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 搜索与运行结束后的状态更新同时进行
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, query := range equivalenceQueries {
+				m.Search(query, WithLimit(20))
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		m.updateScript(scripts[i].ID, func(s *Script) {
+			s.State.bumpFrecency(time.Now())
+		})
+	}
+	wg.Wait()
+}
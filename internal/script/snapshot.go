@@ -0,0 +1,165 @@
+package script
+
+import (
+	"reflect"
+)
+
+// Snapshot 某一时刻的脚本目录，创建后不再修改，可以在多个 goroutine 中同时读取。
+// 脚本中的切片和 map 在快照之间共享，返回给调用方的脚本都是深拷贝。
+type Snapshot struct {
+	version     uint64
+	scripts     []Script
+	index       map[string]int // 脚本 ID 到下标
+	diagnostics []Diagnostic
+}
+
+func newSnapshot(version uint64, scripts []Script, diags []Diagnostic) *Snapshot {
+	index := make(map[string]int, len(scripts))
+	for i, script := range scripts {
+		index[script.ID] = i
+	}
+	return &Snapshot{
+		version:     version,
+		scripts:     scripts,
+		index:       index,
+		diagnostics: diags,
+	}
+}
+
+// Version 返回快照的版本号，脚本目录每次变化时递增
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Len 返回脚本数量
+func (s *Snapshot) Len() int {
+	return len(s.scripts)
+}
+
+// Scripts 返回全部脚本，按 scripts.json 中的顺序排列，自动发现的脚本在后
+func (s *Snapshot) Scripts() []Script {
+	scripts := make([]Script, len(s.scripts))
+	for i := range s.scripts {
+		scripts[i] = s.scripts[i].clone()
+	}
+	return scripts
+}
+
+// Script 根据 ID 查找脚本
+func (s *Snapshot) Script(id string) (Script, bool) {
+	i, ok := s.index[id]
+	if !ok {
+		return Script{}, false
+	}
+	return s.scripts[i].clone(), true
+}
+
+// Diagnostics 返回加载脚本目录时发现的问题
+func (s *Snapshot) Diagnostics() []Diagnostic {
+	diags := make([]Diagnostic, len(s.diagnostics))
+	copy(diags, s.diagnostics)
+	return diags
+}
+
+// Snapshot 返回脚本目录的当前快照
+func (m *Manager) Snapshot() *Snapshot {
+	return m.catalog.Load()
+}
+
+// replaceCatalog 替换整个脚本目录，并发出脚本新增、修改和删除事件
+func (m *Manager) replaceCatalog(scripts []Script, diags []Diagnostic) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 读取状态之后记录的运行结果和置顶修改以状态文件中的为准
+	for i := range scripts {
+		if state, ok := m.state.get(scripts[i].ID); ok {
+			scripts[i].State = state
+		}
+	}
+	old := m.catalog.Load()
+	next := newSnapshot(old.version+1, scripts, diags)
+	m.catalog.Store(next)
+	m.index.replace(scripts)
+
+	for _, script := range scripts {
+		i, ok := old.index[script.ID]
+		switch {
+		case !ok:
+			m.publishScript(EventScriptAdded, script)
+		case !reflect.DeepEqual(old.scripts[i], script):
+			m.publishScript(EventScriptUpdated, script)
+		}
+	}
+	for _, script := range old.scripts {
+		if _, ok := next.index[script.ID]; !ok {
+			m.publish(Event{Type: EventScriptRemoved, ScriptID: script.ID})
+		}
+	}
+}
+
+// updateScript 修改一个脚本并生成新的快照，脚本不存在时不做任何事
+func (m *Manager) updateScript(id string, fn func(*Script)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.catalog.Load()
+	i, ok := old.index[id]
+	if !ok {
+		return
+	}
+	// 只有修改的脚本需要深拷贝，其余脚本与旧快照共享
+	scripts := make([]Script, len(old.scripts))
+	copy(scripts, old.scripts)
+	scripts[i] = scripts[i].clone()
+	fn(&scripts[i])
+	m.catalog.Store(newSnapshot(old.version+1, scripts, old.diagnostics))
+	m.index.update(scripts[i])
+
+	m.publishScript(EventScriptUpdated, scripts[i])
+}
+
+// publishScript 发出脚本新增或修改事件，事件中是脚本的深拷贝
+func (m *Manager) publishScript(typ EventType, script Script) {
+	script = script.clone()
+	m.publish(Event{Type: typ, ScriptID: script.ID, Script: &script})
+}
+
+// clone 返回脚本的深拷贝，不与原脚本共享切片、map 和指针
+func (s Script) clone() Script {
+	if s.Tags != nil {
+		s.Tags = append([]string(nil), s.Tags...)
+	}
+	if s.Args != nil {
+		s.Args = append([]string(nil), s.Args...)
+	}
+	if s.Env != nil {
+		env := make(map[string]string, len(s.Env))
+		for k, v := range s.Env {
+			env[k] = v
+		}
+		s.Env = env
+	}
+	if s.InheritEnv != nil {
+		inherit := *s.InheritEnv
+		s.InheritEnv = &inherit
+	}
+	if s.Params != nil {
+		params := make([]Param, len(s.Params))
+		for i, p := range s.Params {
+			if p.Choices != nil {
+				p.Choices = append([]string(nil), p.Choices...)
+			}
+			params[i] = p
+		}
+		s.Params = params
+	}
+	if s.Requirements != nil {
+		req := *s.Requirements
+		if req.Packages != nil {
+			req.Packages = append([]string(nil), req.Packages...)
+		}
+		s.Requirements = &req
+	}
+	return s
+}
@@ -0,0 +1,59 @@
+package script
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotReturnsCopies(t *testing.T) {
+	m := newTestManager(t)
+	inherit := true
+	want := Script{
+		ID: "a", Name: "a", Path: "a.py",
+		Tags:         []string{"x"},
+		Args:         []string{"--v"},
+		Env:          map[string]string{"K": "V"},
+		InheritEnv:   &inherit,
+		Params:       []Param{{Name: "p", Choices: []string{"1", "2"}}},
+		Requirements: &Requirements{Packages: []string{"requests"}},
+	}
+	m.replaceCatalog([]Script{want.clone()}, nil)
+
+	mutate := func(s *Script) {
+		s.Tags[0] = "changed"
+		s.Args[0] = "changed"
+		s.Env["K"] = "changed"
+		*s.InheritEnv = false
+		s.Params[0].Choices[0] = "changed"
+		s.Requirements.Packages[0] = "changed"
+	}
+	got, _ := m.GetScript("a")
+	mutate(&got)
+	mutate(&m.GetScripts()[0])
+	results, err := m.Search("a")
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Search() = %v, %v", results, err)
+	}
+	mutate(&results[0].Script)
+
+	if got, _ := m.GetScript("a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetScript() = %+v after mutating copies, want %+v", got, want)
+	}
+}
+
+func TestPinnedScriptsReturnsCopies(t *testing.T) {
+	m := newTestManager(t)
+	m.replaceCatalog([]Script{{ID: "a", Name: "a", Path: "a.py", Tags: []string{"x"}}}, nil)
+	if err := m.SetPinned("a", true); err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := m.PinnedScripts()
+	if len(pinned) != 1 {
+		t.Fatalf("PinnedScripts() = %v, want one script", pinned)
+	}
+	pinned[0].Tags[0] = "changed"
+	if got, _ := m.GetScript("a"); got.Tags[0] != "x" {
+		t.Errorf("tags after mutating PinnedScripts() = %v, want [x]", got.Tags)
+	}
+}
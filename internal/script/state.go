@@ -0,0 +1,285 @@
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yahao333/x-script/internal/utils"
+)
+
+// 运行时状态文件的格式版本，版本 1 中有按脚本名称保存的状态，版本 2 起只以脚本 ID 为键
+const stateVersion = 2
+
+// ScriptState 脚本的运行时状态，保存在应用数据目录下，不写回 scripts.json
+type ScriptState struct {
+	LastRunTime  time.Time     `json:"last_run_time"`
+	LastStatus   RunState      `json:"last_status,omitempty"`
+	LastExitCode int           `json:"last_exit_code"`
+	LastDuration time.Duration `json:"last_duration"`
+	RunCount     int           `json:"run_count"`
+	FailCount    int           `json:"fail_count"`
+
+	// 频率分数，在 FrecencyTime 时的值，用 FrecencyAt 计算当前值
+	Frecency     float64   `json:"frecency"`
+	FrecencyTime time.Time `json:"frecency_time"`
+
+	// 置顶的脚本在搜索结果中排在最前面，按 PinOrder 从小到大排列
+	Pinned   bool `json:"pinned,omitempty"`
+	PinOrder int  `json:"pin_order,omitempty"`
+	// 隐藏的脚本默认不出现在搜索结果中
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// stateStore 读写运行时状态文件。图形界面和命令行是不同的进程，共用同一个文件，
+// 写回时在文件锁内重新读取文件，只写入本进程修改过的脚本。
+type stateStore struct {
+	mu      sync.Mutex
+	path    string
+	scripts map[string]ScriptState
+	dirty   map[string]bool // 修改过、还没有写回文件的脚本，删除的脚本不在 scripts 中
+	legacy  bool            // 状态文件是旧版本，还没有迁移按名称保存的状态
+}
+
+type stateFile struct {
+	Version int                    `json:"version"`
+	Scripts map[string]ScriptState `json:"scripts"` // 以脚本 ID 为键
+}
+
+func newStateStore(path string) *stateStore {
+	return &stateStore{
+		path:    path,
+		scripts: make(map[string]ScriptState),
+		dirty:   make(map[string]bool),
+	}
+}
+
+// load 读取状态文件，与内存中还没有写回的修改合并，文件不存在时保留内存中的状态
+func (s *stateStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.syncLocked()
+}
+
+// read 读取状态文件，文件不存在时返回 nil
+func (s *stateStore) read() (*stateFile, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state file failed: %w", err)
+	}
+
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse state file failed: %w", err)
+	}
+	if file.Scripts == nil {
+		file.Scripts = make(map[string]ScriptState)
+	}
+	return &file, nil
+}
+
+func (s *stateStore) get(key string) (ScriptState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.scripts[key]
+	return state, ok
+}
+
+// rekey 把 from 下的状态移到 to 下，to 下已有状态时不移动。
+// 只修改内存中的状态，下次 update 或 save 时写回文件。
+func (s *stateStore) rekey(from, to string) (ScriptState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.scripts[from]
+	if !ok || from == to {
+		return state, ok
+	}
+	if _, exists := s.scripts[to]; exists {
+		return ScriptState{}, false
+	}
+	delete(s.scripts, from)
+	s.scripts[to] = state
+	s.dirty[from], s.dirty[to] = true, true
+	return state, true
+}
+
+// migrateNames 把旧版本状态文件中按脚本名称保存的状态迁移到脚本 ID 下并写回文件，只执行一次。
+// 名称同时是某个脚本的 ID、对应多个脚本或者 ID 下已有状态时不迁移。
+func (s *stateStore) migrateNames(scripts []Script) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.legacy {
+		return nil
+	}
+	unlock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// 其他进程可能已经迁移过
+	s.syncLocked()
+	if !s.legacy {
+		return nil
+	}
+
+	ids := make(map[string]bool, len(scripts))
+	names := make(map[string]int, len(scripts))
+	for _, script := range scripts {
+		ids[script.ID] = true
+		names[script.Name]++
+	}
+	for _, script := range scripts {
+		state, ok := s.scripts[script.Name]
+		if !ok || ids[script.Name] || names[script.Name] > 1 {
+			continue
+		}
+		if _, exists := s.scripts[script.ID]; exists {
+			continue
+		}
+		delete(s.scripts, script.Name)
+		s.scripts[script.ID] = state
+		s.dirty[script.Name], s.dirty[script.ID] = true, true
+	}
+	s.legacy = false
+	if err := s.writeLocked(); err != nil {
+		s.legacy = true
+		return err
+	}
+	return nil
+}
+
+// save 写回状态文件
+func (s *stateStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+// update 在文件锁内读取脚本的最新状态，修改后写回文件
+func (s *stateStore) update(key string, fn func(*ScriptState)) (ScriptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, lockErr := s.lockFile()
+	if lockErr == nil {
+		defer unlock()
+		s.syncLocked()
+	}
+	state := s.scripts[key]
+	fn(&state)
+	s.scripts[key] = state
+	s.dirty[key] = true
+	if lockErr != nil {
+		// 修改保留在内存中，下次写回时重试
+		return state, lockErr
+	}
+	return state, s.writeLocked()
+}
+
+// saveLocked 在文件锁内合并状态文件后写回，调用方需持有 mu
+func (s *stateStore) saveLocked() error {
+	unlock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	s.syncLocked()
+	return s.writeLocked()
+}
+
+// lockFile 获取状态文件的进程间锁，读取、修改和写回文件期间持有
+func (s *stateStore) lockFile() (func(), error) {
+	unlock, err := utils.LockFile(s.path + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("lock state file failed: %w", err)
+	}
+	return unlock, nil
+}
+
+// syncLocked 用状态文件中的内容替换内存中的状态，保留本进程还没有写回的修改。
+// 文件不存在或者无法读取时保留内存中的状态。
+func (s *stateStore) syncLocked() error {
+	file, err := s.read()
+	if err != nil || file == nil {
+		return err
+	}
+	s.legacy = file.Version < stateVersion
+	scripts := file.Scripts
+	for key := range s.dirty {
+		if state, ok := s.scripts[key]; ok {
+			scripts[key] = state
+		} else {
+			delete(scripts, key)
+		}
+	}
+	s.scripts = scripts
+	return nil
+}
+
+// writeLocked 原子地写入状态文件，调用方需持有 mu 和文件锁
+func (s *stateStore) writeLocked() error {
+	version := stateVersion
+	if s.legacy {
+		// 还没有迁移按名称保存的状态时保留旧版本号，下次加载时再迁移
+		version = stateVersion - 1
+	}
+	data, err := json.MarshalIndent(stateFile{
+		Version: version,
+		Scripts: s.scripts,
+	}, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal state failed: %w", err)
+	}
+	if err := utils.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write state file failed: %w", err)
+	}
+	clear(s.dirty)
+	return nil
+}
+
+func statePath(dataDir string) string {
+	return filepath.Join(dataDir, "state.json")
+}
+
+// updateState 修改脚本的运行时状态，写回状态文件并更新脚本目录
+func (m *Manager) updateState(script Script, fn func(*ScriptState)) error {
+	updated, err := m.state.update(script.ID, func(s *ScriptState) {
+		if *s == (ScriptState{}) {
+			// 还没有保存过状态，保留从 scripts.json 迁移来的 last_run_time
+			*s = script.State
+		}
+		fn(s)
+	})
+	m.updateScript(script.ID, func(s *Script) {
+		s.State = updated
+	})
+	return err
+}
+
+// recordResult 把运行结果记入脚本状态
+func (m *Manager) recordResult(script Script, state RunState, result *RunResult) {
+	err := m.updateState(script, func(s *ScriptState) {
+		s.LastRunTime = result.StartTime
+		s.LastStatus = state
+		s.LastExitCode = result.ExitCode
+		s.LastDuration = result.Duration
+		s.bumpFrecency(result.StartTime)
+		s.RunCount++
+		if state == RunFailed {
+			s.FailCount++
+		}
+	})
+	if err != nil {
+		m.logger.WithError(err).Error("Failed to save script state")
+	}
+}
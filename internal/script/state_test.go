@@ -0,0 +1,151 @@
+package script
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRecordResultKeepsLegacyState(t *testing.T) {
+	m := newTestManager(t)
+	legacy := time.Now().Add(-time.Hour).Truncate(time.Second)
+	m.replaceCatalog([]Script{
+		{ID: "a", Name: "a", Path: "a.py", State: ScriptState{LastRunTime: legacy, FailCount: 2}},
+	}, nil)
+	script, _ := m.GetScript("a")
+
+	start := time.Now()
+	m.recordResult(script, RunSucceeded, &RunResult{StartTime: start, Duration: time.Second})
+
+	got, _ := m.GetScript("a")
+	if got.State.FailCount != 2 {
+		t.Error("state from scripts.json was dropped")
+	}
+	if got.State.RunCount != 1 || !got.State.LastRunTime.Equal(start) {
+		t.Errorf("state = %+v, want one run at %v", got.State, start)
+	}
+	if saved, _ := m.state.get("a"); saved != got.State {
+		t.Errorf("saved state = %+v, want %+v", saved, got.State)
+	}
+}
+
+func TestStateSharedBetweenManagers(t *testing.T) {
+	// 图形界面和命令行是共用数据目录的两个进程
+	gui := newTestManager(t)
+	cli := NewManager(gui.config, gui.logger)
+	scripts := []Script{
+		{ID: "a", Name: "a", Path: "a.py"},
+		{ID: "b", Name: "b", Path: "b.py"},
+	}
+	gui.replaceCatalog(scripts, nil)
+	cli.replaceCatalog(scripts, nil)
+
+	start := time.Now()
+	a, _ := gui.GetScript("a")
+	gui.recordResult(a, RunSucceeded, &RunResult{StartTime: start})
+	if err := cli.SetPinned("b", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SetHidden("a", true); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := gui.GetScript("b")
+	gui.recordResult(b, RunFailed, &RunResult{StartTime: start})
+
+	reloaded := newStateStore(gui.state.path)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reloaded.get("a"); got.RunCount != 1 || !got.Hidden {
+		t.Errorf("state of a = %+v, want one run and hidden", got)
+	}
+	if got, _ := reloaded.get("b"); got.FailCount != 1 || !got.Pinned {
+		t.Errorf("state of b = %+v, want one failure and pinned", got)
+	}
+}
+
+func TestMigrateNameKeyedState(t *testing.T) {
+	m := newTestManager(t)
+	writeScriptFile(t, m, "scripts.json", `{"scripts": [
+		{"id": "build", "name": "Build", "path": "build.py"},
+		{"id": "deploy", "name": "Deploy", "path": "deploy.py"},
+		{"id": "tool", "name": "deploy", "path": "tool.py"}
+	]}`)
+	legacy := []byte(`{"version": 1, "scripts": {"Build": {"run_count": 3}, "deploy": {"run_count": 5}}}`)
+	if err := os.MkdirAll(m.dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(m.state.path, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 被拒绝的修改只检查条目，不迁移状态
+	if err := m.state.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddScript(Script{Name: "Bad", Path: "../bad.py"}); err == nil {
+		t.Fatal("AddScript() with path outside scripts dir succeeded")
+	}
+	if data, _ := os.ReadFile(m.state.path); !bytes.Equal(data, legacy) {
+		t.Fatalf("state file changed by rejected add:\n%s", data)
+	}
+
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	// 名称是现有脚本 ID 的旧状态属于该 ID，不迁移给同名的脚本
+	for id, want := range map[string]int{"build": 3, "deploy": 5, "tool": 0} {
+		if s, _ := m.GetScript(id); s.State.RunCount != want {
+			t.Errorf("run count of %s = %d, want %d", id, s.State.RunCount, want)
+		}
+	}
+	if _, ok := m.state.get("Build"); ok {
+		t.Error("name-keyed state still present after migration")
+	}
+
+	reloaded := newStateStore(m.state.path)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.legacy {
+		t.Error("state file still has the legacy version after migration")
+	}
+}
+
+func TestReplaceCatalogKeepsNewerState(t *testing.T) {
+	m := newTestManager(t)
+	scripts := []Script{{ID: "a", Name: "a", Path: "a.py"}}
+	m.replaceCatalog(scripts, nil)
+
+	// 加载读取状态之后才记录的运行结果不会被加载结果覆盖
+	stale := []Script{{ID: "a", Name: "a", Path: "a.py"}}
+	a, _ := m.GetScript("a")
+	m.recordResult(a, RunSucceeded, &RunResult{StartTime: time.Now()})
+	m.replaceCatalog(stale, nil)
+
+	if got, _ := m.GetScript("a"); got.State.RunCount != 1 {
+		t.Errorf("run count after reload = %d, want 1", got.State.RunCount)
+	}
+}
+
+func TestReloadKeepsUnsavedState(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.state.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.state.update("a", func(s *ScriptState) { s.RunCount = 1 }); err != nil {
+		t.Fatal(err)
+	}
+	// 内存中还没有写回的修改在重新读取文件后仍然保留
+	m.state.rekey("a", "b")
+	if err := m.state.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.state.get("a"); ok {
+		t.Error("state moved away from a came back after reload")
+	}
+	if got, _ := m.state.get("b"); got.RunCount != 1 {
+		t.Errorf("state of b after reload = %+v, want the unsaved state", got)
+	}
+}
@@ -0,0 +1,144 @@
+package script
+
+import (
+	"sort"
+	"strings"
+)
+
+// TagCount 标签及使用该标签的脚本数量
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Category 分类树中的一个节点
+type Category struct {
+	Name     string     `json:"name"`  // 最后一级的名称
+	Path     string     `json:"path"`  // 完整路径，如 "dev/build"
+	Count    int        `json:"count"` // 该分类及其子分类中的脚本数量
+	Children []Category `json:"children,omitempty"`
+}
+
+// splitTags 把逗号分隔的文本拆分为标签
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// normalizeTags 去掉标签两端的空白和空标签，忽略大小写去重，保留第一次出现的写法
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// normalizeCategory 去掉每一级两端的空白和空的层级，如 " dev / build/ " 转换为 "dev/build"
+func normalizeCategory(category string) string {
+	var parts []string
+	for _, part := range strings.Split(category, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// inCategory 判断分类 category 是否为 parent 或其子分类，忽略大小写，两者都已规范化
+func inCategory(category, parent string) bool {
+	if len(category) < len(parent) || !strings.EqualFold(category[:len(parent)], parent) {
+		return false
+	}
+	return len(category) == len(parent) || category[len(parent)] == '/'
+}
+
+// Tags 返回所有标签及使用数量，按数量从多到少排列。
+// 标签忽略大小写合并，使用第一次出现的写法。
+func (s *Snapshot) Tags() []TagCount {
+	var tags []TagCount
+	index := make(map[string]int)
+	for _, script := range s.scripts {
+		for _, tag := range script.Tags {
+			key := strings.ToLower(tag)
+			i, ok := index[key]
+			if !ok {
+				i = len(tags)
+				index[key] = i
+				tags = append(tags, TagCount{Tag: tag})
+			}
+			tags[i].Count++
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return strings.ToLower(tags[i].Tag) < strings.ToLower(tags[j].Tag)
+	})
+	return tags
+}
+
+// Categories 返回分类树，同一层的分类按名称排列，没有分类的脚本不计入
+func (s *Snapshot) Categories() []Category {
+	root := &Category{}
+	for _, script := range s.scripts {
+		if script.Category == "" {
+			continue
+		}
+		node := root
+		path := ""
+		for _, name := range strings.Split(script.Category, "/") {
+			if path != "" {
+				path += "/"
+			}
+			path += name
+			node = node.child(name, path)
+			node.Count++
+		}
+	}
+	root.sort()
+	return root.Children
+}
+
+// child 返回名称为 name 的子分类，忽略大小写，不存在时创建
+func (c *Category) child(name, path string) *Category {
+	for i := range c.Children {
+		if strings.EqualFold(c.Children[i].Name, name) {
+			return &c.Children[i]
+		}
+	}
+	c.Children = append(c.Children, Category{Name: name, Path: path})
+	return &c.Children[len(c.Children)-1]
+}
+
+func (c *Category) sort() {
+	sort.Slice(c.Children, func(i, j int) bool {
+		return strings.ToLower(c.Children[i].Name) < strings.ToLower(c.Children[j].Name)
+	})
+	for i := range c.Children {
+		c.Children[i].sort()
+	}
+}
+
+// Tags 返回所有标签及使用数量，用于显示标签过滤
+func (m *Manager) Tags() []TagCount {
+	return m.Snapshot().Tags()
+}
+
+// Categories 返回分类树及每个分类中的脚本数量，用于分组显示
+func (m *Manager) Categories() []Category {
+	return m.Snapshot().Categories()
+}
@@ -0,0 +1,286 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yahao333/x-script/pkg/logger"
+)
+
+// 虚拟环境创建完成的标记文件，内容为依赖的哈希值，修改时间为最后一次使用的时间
+const venvReadyFile = ".x-script-ready"
+
+// venvRetention 不再被任何脚本使用的虚拟环境保留的时间，之后清理
+const venvRetention = 24 * time.Hour
+
+// Requirements 脚本依赖，在 scripts.json 中可以写成 requirements 文件路径或依赖列表
+type Requirements struct {
+	File     string   // requirements 文件，相对路径基于 ScriptsDir
+	Packages []string // 依赖列表，格式与 pip install 参数相同
+}
+
+// UnmarshalJSON 支持字符串和字符串数组两种写法
+func (r *Requirements) UnmarshalJSON(data []byte) error {
+	var file string
+	if err := json.Unmarshal(data, &file); err == nil {
+		*r = Requirements{File: file}
+		return nil
+	}
+	var packages []string
+	if err := json.Unmarshal(data, &packages); err != nil {
+		return fmt.Errorf("requirements must be a file path or a list of packages")
+	}
+	*r = Requirements{Packages: packages}
+	return nil
+}
+
+// MarshalJSON 按原来的写法序列化
+func (r Requirements) MarshalJSON() ([]byte, error) {
+	if r.File != "" {
+		return json.Marshal(r.File)
+	}
+	return json.Marshal(r.Packages)
+}
+
+// Empty 返回是否没有声明依赖
+func (r *Requirements) Empty() bool {
+	return r == nil || (r.File == "" && len(r.Packages) == 0)
+}
+
+// venvLocks 按虚拟环境目录加锁，避免并发运行重复创建同一个环境
+type venvLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (l *venvLocks) lock(dir string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := l.locks[dir]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[dir] = lock
+	}
+	l.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// requirementsFile 返回 requirements 文件的绝对路径
+func (m *Manager) requirementsFile(req *Requirements) string {
+	if filepath.IsAbs(req.File) {
+		return req.File
+	}
+	return filepath.Join(m.config.ScriptsDir, req.File)
+}
+
+// validateRequirements 检查脚本的依赖声明
+func (m *Manager) validateRequirements(script Script) error {
+	if script.Requirements.Empty() {
+		return nil
+	}
+	if script.Requirements.File != "" {
+		if _, err := os.Stat(m.requirementsFile(script.Requirements)); err != nil {
+			return fmt.Errorf("requirements file not accessible: %w", err)
+		}
+	}
+	for _, pkg := range script.Requirements.Packages {
+		if strings.TrimSpace(pkg) == "" || strings.HasPrefix(pkg, "-") {
+			return fmt.Errorf("invalid requirement %q", pkg)
+		}
+	}
+	return nil
+}
+
+// requirementsHash 根据解释器、依赖内容和安装源计算虚拟环境的哈希值
+func (m *Manager) requirementsHash(req *Requirements, python string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "python=%s\nwheelhouse=%s\nindex=%s\n", python, m.config.Wheelhouse, m.config.PackageIndex)
+
+	if req.File != "" {
+		data, err := os.ReadFile(m.requirementsFile(req))
+		if err != nil {
+			return "", fmt.Errorf("read requirements file failed: %w", err)
+		}
+		h.Write(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")))
+	} else {
+		packages := append([]string(nil), req.Packages...)
+		sort.Strings(packages)
+		h.Write([]byte(strings.Join(packages, "\n")))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// ensureVenv 为脚本准备虚拟环境并返回其中的 Python 路径。
+// 虚拟环境按依赖哈希缓存在应用数据目录下，依赖变化时自动创建新的环境。
+func (m *Manager) ensureVenv(ctx context.Context, script Script, python string, progress func(string)) (string, error) {
+	req := script.Requirements
+	if python == "" {
+		python = m.config.PythonPath
+	}
+	hash, err := m.requirementsHash(req, python)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(m.dataDir, "venvs", hash)
+	venvPy := venvPython(dir)
+
+	unlock := m.venvLocks.lock(dir)
+	defer unlock()
+
+	stampPath := filepath.Join(dir, venvReadyFile)
+	if stamp, err := os.ReadFile(stampPath); err == nil && string(stamp) == hash {
+		now := time.Now()
+		os.Chtimes(stampPath, now, now)
+		return venvPy, nil
+	}
+
+	m.logger.WithFields(logger.Fields{
+		"scriptName": script.Name,
+		"venv":       dir,
+	}).Info("Creating virtual environment")
+	progress(fmt.Sprintf("Creating virtual environment for '%s'", script.Name))
+
+	// 上次创建失败时残留的目录需要先删除
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("remove stale virtual environment failed: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("create venvs directory failed: %w", err)
+	}
+
+	if err := m.runSetup(ctx, progress, python, "-m", "venv", dir); err != nil {
+		return "", fmt.Errorf("create virtual environment failed: %w", err)
+	}
+
+	args := []string{"-m", "pip", "install", "--disable-pip-version-check"}
+	if m.config.Wheelhouse != "" {
+		args = append(args, "--no-index", "--find-links", m.config.Wheelhouse)
+	} else if m.config.PackageIndex != "" {
+		args = append(args, "--index-url", m.config.PackageIndex)
+	}
+	if req.File != "" {
+		args = append(args, "-r", m.requirementsFile(req))
+	} else {
+		args = append(args, req.Packages...)
+	}
+	if err := m.runSetup(ctx, progress, venvPy, args...); err != nil {
+		return "", fmt.Errorf("install requirements failed: %w", err)
+	}
+
+	if err := os.WriteFile(stampPath, []byte(hash), 0644); err != nil {
+		return "", fmt.Errorf("write virtual environment stamp failed: %w", err)
+	}
+	progress("Virtual environment ready")
+
+	// 依赖变化后旧的环境不再使用
+	go m.pruneVenvs()
+	return venvPy, nil
+}
+
+// pruneVenvs 删除当前脚本目录中没有脚本使用、且超过 venvRetention 没有使用的虚拟环境
+func (m *Manager) pruneVenvs() {
+	root := filepath.Join(m.dataDir, "venvs")
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+
+	used := make(map[string]bool)
+	for _, script := range m.Snapshot().scripts {
+		if script.Requirements.Empty() {
+			continue
+		}
+		interp, err := m.resolveInterpreter(script)
+		if err != nil {
+			continue
+		}
+		python := interp.Command
+		if python == "" {
+			python = m.config.PythonPath
+		}
+		if hash, err := m.requirementsHash(script.Requirements, python); err == nil {
+			used[hash] = true
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || used[entry.Name()] {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		// 创建失败残留的目录没有标记文件，按目录的修改时间判断
+		info, err := os.Stat(filepath.Join(dir, venvReadyFile))
+		if err != nil {
+			info, err = entry.Info()
+		}
+		if err != nil || time.Since(info.ModTime()) < venvRetention {
+			continue
+		}
+
+		// 先删除标记文件，删除中途失败时下次使用会重新创建
+		unlock := m.venvLocks.lock(dir)
+		err = os.Remove(filepath.Join(dir, venvReadyFile))
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			err = os.RemoveAll(dir)
+		}
+		unlock()
+		if err != nil {
+			m.logger.WithError(err).WithField("venv", dir).Warn("Failed to remove stale virtual environment")
+			continue
+		}
+		m.logger.WithField("venv", dir).Info("Removed stale virtual environment")
+	}
+}
+
+// runSetup 运行创建虚拟环境的命令，逐行转发输出
+func (m *Manager) runSetup(ctx context.Context, progress func(string), name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	w := &progressWriter{splitter: lineSplitter{emit: func(kind OutputKind, data []byte) bool {
+		if kind == OutputLine {
+			line := string(toValidUTF8(data, true))
+			m.logger.Debug(line)
+			progress(line)
+		}
+		return true
+	}}}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	w.splitter.close()
+	return err
+}
+
+// progressWriter 把命令输出切分成行，Stdout 和 Stderr 共用时由 exec 保证串行写入
+type progressWriter struct {
+	splitter lineSplitter
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.splitter.write(p)
+	return len(p), nil
+}
+
+// isPythonInterpreter 判断解释器是否为 Python
+func isPythonInterpreter(interp Interpreter) bool {
+	if interp.Name == InterpreterPython {
+		return true
+	}
+	return strings.HasPrefix(strings.ToLower(filepath.Base(interp.Command)), "python")
+}
@@ -0,0 +1,120 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// watchDebounce 最后一次文件变化后等待的时间，合并编辑器保存时的多次写入
+	watchDebounce = 300 * time.Millisecond
+	// pollInterval 不支持文件通知时轮询 ScriptsDir 的间隔
+	pollInterval = 2 * time.Second
+)
+
+// Watch 监视 scripts.json 和 ScriptsDir 的变化，变化后自动重新加载，ctx 取消时停止。
+// Linux 下使用 inotify，其他平台或 inotify 不可用时轮询。
+func (m *Manager) Watch(ctx context.Context) error {
+	root := m.config.ScriptsDir
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("watch scripts dir failed: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("watch scripts dir failed: %q is not a directory", root)
+	}
+
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		err := watchDir(ctx, root, notify)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		m.logger.WithError(err).Info("File notification unavailable, polling scripts dir")
+		pollDir(ctx, root, notify)
+	}()
+	go m.reloadOnChange(ctx, changes)
+
+	m.logger.WithField("scriptsDir", root).Debug("Watching scripts")
+	return nil
+}
+
+// Reload 重新加载脚本并发出 EventCatalogChanged 事件。
+// 加载失败时保留上一次成功加载的脚本。
+func (m *Manager) Reload() error {
+	err := m.Load()
+	if err != nil {
+		m.logger.WithError(err).Error("Failed to reload scripts, keeping previous catalog")
+	}
+	m.publish(Event{Type: EventCatalogChanged, Err: err})
+	return err
+}
+
+// reloadOnChange 合并短时间内的多次变化后重新加载
+func (m *Manager) reloadOnChange(ctx context.Context, changes <-chan struct{}) {
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			timer.Reset(watchDebounce)
+		case <-timer.C:
+			m.Reload()
+		}
+	}
+}
+
+// pollDir 定期比较目录指纹，变化时调用 notify
+func pollDir(ctx context.Context, root string, notify func()) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	last := dirFingerprint(root)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if current := dirFingerprint(root); current != last {
+				last = current
+				notify()
+			}
+		}
+	}
+}
+
+// dirFingerprint 根据文件路径、大小和修改时间计算目录指纹，跳过的目录与自动发现一致
+func dirFingerprint(root string) uint64 {
+	h := fnv.New64a()
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path != root && skipScanDir(path, d.Name()) {
+			return fs.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64()
+}
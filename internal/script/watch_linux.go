@@ -0,0 +1,118 @@
+//go:build linux
+
+package script
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB | unix.IN_DELETE_SELF
+
+// watchDir 用 inotify 监视 root 及其子目录，直到 ctx 取消。
+// 无法初始化 inotify 时返回错误，由调用方改用轮询。
+func watchDir(ctx context.Context, root string, notify func()) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify init failed: %w", err)
+	}
+	defer unix.Close(fd)
+
+	dirs := make(map[int]string)
+	addTree := func(dir string) error {
+		return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if path != root && skipScanDir(path, d.Name()) {
+				return fs.SkipDir
+			}
+			wd, err := unix.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				if path == root {
+					return fmt.Errorf("inotify watch %q failed: %w", path, err)
+				}
+				return nil
+			}
+			dirs[wd] = path
+			return nil
+		})
+	}
+	if err := addTree(root); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64*1024)
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for ctx.Err() == nil {
+		// 定时返回以检查 ctx
+		n, err := unix.Poll(fds, 500)
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("inotify poll failed: %w", err)
+		}
+
+		n, err = unix.Read(fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("inotify read failed: %w", err)
+		}
+
+		changed := false
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				changed = true
+				continue
+			}
+			dir, ok := dirs[int(event.Wd)]
+			if !ok {
+				continue
+			}
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(dirs, int(event.Wd))
+				continue
+			}
+
+			name := string(trimNUL(buf[nameStart:offset]))
+			path := filepath.Join(dir, name)
+			if event.Mask&unix.IN_ISDIR != 0 {
+				// 跳过的目录（如 .venv、__pycache__）中的变化不影响脚本目录
+				if name != "" && skipScanDir(path, name) {
+					continue
+				}
+				if event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+					addTree(path)
+				}
+			}
+			changed = true
+		}
+		if changed {
+			notify()
+		}
+	}
+	return nil
+}
+
+// trimNUL 去掉 inotify 事件中文件名末尾填充的 NUL
+func trimNUL(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
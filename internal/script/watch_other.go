@@ -0,0 +1,13 @@
+//go:build !linux
+
+package script
+
+import (
+	"context"
+	"errors"
+)
+
+// watchDir 当前平台没有实现文件通知，由调用方改用轮询
+func watchDir(ctx context.Context, root string, notify func()) error {
+	return errors.ErrUnsupported
+}
@@ -3,18 +3,28 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/sirupsen/logrus"
 	"github.com/yahao333/x-script/internal/app"
+	"github.com/yahao333/x-script/internal/cli"
 	"github.com/yahao333/x-script/internal/utils"
 	"github.com/yahao333/x-script/pkg/config"
 	"github.com/yahao333/x-script/pkg/logger"
 )
 
 func main() {
+	// 第一个参数是子命令时作为命令行工具运行，其他参数不影响图形界面启动
+	cliMode := len(os.Args) > 1 && cli.IsCommand(os.Args[1])
+	if cliMode {
+		cli.AttachConsole()
+	}
+
 	// 获取应用数据目录
 	appDataDir := utils.GetAppDataDir()
-	fmt.Println("log appDataDir:", appDataDir)
+	if !cliMode {
+		fmt.Println("log appDataDir:", appDataDir)
+	}
 
 	// 加载配置
 	cfg, err := config.Load(appDataDir)
@@ -22,13 +32,23 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// 初始化日志
-	logger, err := logger.New(cfg, appDataDir)
+	// 初始化日志，命令行模式下日志只写入文件
+	var opts []logger.Option
+	if cliMode {
+		opts = append(opts, logger.WithoutConsole())
+	}
+	logger, err := logger.New(cfg, appDataDir, opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer logger.Close()
 
+	if cliMode {
+		code := cli.New(cfg, logger).Run(os.Args[1:])
+		logger.Close()
+		os.Exit(code)
+	}
+
 	logger.Info("Application starting...")
 	logger.WithFields(logrus.Fields{
 		"appDataDir": appDataDir,
@@ -6,6 +6,14 @@ import (
 	"path/filepath"
 )
 
+// InterpreterProfile 解释器配置，Command 为空表示直接执行脚本文件
+type InterpreterProfile struct {
+	Command    string            `json:"command"`
+	Args       []string          `json:"args,omitempty"`       // 放在脚本路径之前的参数，例如 -u
+	Env        map[string]string `json:"env,omitempty"`        // 值支持 ${VAR} 引用
+	Extensions []string          `json:"extensions,omitempty"` // 按扩展名匹配脚本，例如 .py
+}
+
 type AppConfig struct {
 	// 窗口配置
 	WindowWidth  int `json:"window_width"`
@@ -14,8 +22,27 @@ type AppConfig struct {
 	WindowY      int `json:"window_y"`
 
 	// Python配置
-	PythonPath string `json:"python_path"`
-	ScriptsDir string `json:"scripts_dir"`
+	PythonPath       string `json:"python_path"`
+	ScriptsDir       string `json:"scripts_dir"`
+	MinPythonVersion string `json:"min_python_version"` // 启动时检查的最低 Python 版本，为空不检查
+	Wheelhouse       string `json:"wheelhouse"`         // 安装脚本依赖的本地 wheel 目录，设置后不访问网络
+	PackageIndex     string `json:"package_index"`      // 安装脚本依赖的 pip 索引地址，为空使用 pip 默认配置
+	AutoDiscover     bool   `json:"auto_discover"`      // 自动登记 ScriptsDir 中未写入 scripts.json 的脚本
+	WatchScripts     bool   `json:"watch_scripts"`      // scripts.json 或 ScriptsDir 变化时自动重新加载
+
+	// 解释器配置，与内置的 python、bash、node、pwsh、go、exec 同名时覆盖内置配置
+	Interpreters map[string]InterpreterProfile `json:"interpreters,omitempty"`
+
+	// 脚本执行配置
+	StopGracePeriod int    `json:"stop_grace_period"` // 停止脚本时发送中断后等待的秒数，超时后强制结束进程组；Windows 界面没有控制台，直接结束
+	OutputEncoding  string `json:"output_encoding"`   // 脚本输出编码：auto、utf-8、gbk、utf-16、utf-16le、utf-16be
+
+	// 搜索配置
+	Ranking string `json:"ranking"` // 脚本排序方式：frecency、recent、alphabetical、manual
+
+	// 运行历史配置，超出条数或天数的记录及其输出被删除，为 0 时不限制
+	HistoryMaxRecords int `json:"history_max_records"`
+	HistoryMaxDays    int `json:"history_max_days"`
 
 	// 日志配置
 	LogFile     string `json:"log_file"`
@@ -26,15 +53,22 @@ type AppConfig struct {
 }
 
 var DefaultConfig = AppConfig{
-	WindowWidth:  300,
-	WindowHeight: 200,
-	PythonPath:   "python",
-	ScriptsDir:   "scripts",
-	LogFile:      "logs/x-script.log",
-	LogLevel:     "info",
-	DebugMode:    false,
-	MaxLogSize:   10,
-	MaxLogFiles:  3,
+	WindowWidth:       300,
+	WindowHeight:      200,
+	PythonPath:        "python",
+	ScriptsDir:        "scripts",
+	MinPythonVersion:  "3.8",
+	WatchScripts:      true,
+	StopGracePeriod:   5,
+	OutputEncoding:    "auto",
+	Ranking:           "frecency",
+	HistoryMaxRecords: 1000,
+	HistoryMaxDays:    30,
+	LogFile:           "logs/x-script.log",
+	LogLevel:          "info",
+	DebugMode:         false,
+	MaxLogSize:        10,
+	MaxLogFiles:       3,
 }
 
 func Load(configDir string) (*AppConfig, error) {
@@ -49,7 +83,8 @@ func Load(configDir string) (*AppConfig, error) {
 		return nil, err
 	}
 
-	var config AppConfig
+	// 以默认配置为基础，旧配置文件缺少的字段保持默认值
+	config := DefaultConfig
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
@@ -24,6 +24,7 @@ type Logger struct {
 	config     *config.AppConfig
 	file       *os.File
 	outputPath string
+	console    bool // 是否同时输出到控制台，轮转日志文件后保持不变
 }
 
 // Fields 类型别名，用于结构化日志
@@ -32,6 +33,14 @@ type Fields = logrus.Fields
 // Option 定义logger的配置选项
 type Option func(*Logger)
 
+// WithoutConsole 只写入日志文件，不输出到控制台，用于命令行模式
+func WithoutConsole() Option {
+	return func(l *Logger) {
+		l.console = false
+		l.SetOutput(l.file)
+	}
+}
+
 type customFormatter struct {
 	logrus.TextFormatter
 }
@@ -106,6 +115,7 @@ func New(cfg *config.AppConfig, baseDir string, opts ...Option) (*Logger, error)
 		config:     cfg,
 		file:       file,
 		outputPath: logPath,
+		console:    true,
 	}
 
 	// 设置默认格式化器
@@ -257,7 +267,7 @@ func (h *rotationHook) rotate() error {
 	}
 
 	h.logger.file = file
-	if h.logger.config.DebugMode {
+	if h.logger.config.DebugMode && h.logger.console {
 		h.logger.SetOutput(io.MultiWriter(file, os.Stdout))
 	} else {
 		h.logger.SetOutput(file)
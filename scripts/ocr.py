@@ -1,3 +1,4 @@
+# x-script: name=OCR 识别, keywords=ocr, image
 import asyncio
 from PIL import Image
 import winrt.windows.media.ocr as ocr
@@ -1,4 +1,5 @@
 # -*- coding: utf-8 -*-
+# x-script: name=企业微信助手, keywords=wxwork, wechat, ocr
 import pygetwindow as gw
 import pyautogui
 from PIL import Image